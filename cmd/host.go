@@ -22,9 +22,12 @@ import (
 )
 
 var (
-	hostName string
-	hostUser string
-	hostTags string
+	hostName         string
+	hostUser         string
+	hostTags         string
+	hostLabels       string
+	hostLabelColumns []string
+	hostRefresh      bool
 )
 
 // hostCmd represents the host command
@@ -33,7 +36,8 @@ var hostCmd = &cobra.Command{
 	Short: "host configs manage",
 	Long:  "host configs manage",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return config.ListConfigHosts(hostName, hostUser, hostTags)
+		config.InventoryRefresh = hostRefresh
+		return config.ListConfigHosts(hostName, hostUser, hostTags, hostLabels, hostLabelColumns)
 	},
 }
 
@@ -41,6 +45,9 @@ func init() {
 	hostCmd.Flags().Bool("help", false, "help for this command.")
 	hostCmd.Flags().StringVarP(&hostName, "name", "n", "", "host name")
 	hostCmd.Flags().StringVarP(&hostUser, "user", "u", "", "login username")
-	hostCmd.Flags().StringVarP(&hostTags, "tags", "t", "", "tags")
+	hostCmd.Flags().StringVarP(&hostTags, "tags", "t", "", "tags selector, such as \"web&prod\", \"db,!staging\" or \"region-*\"")
+	hostCmd.Flags().StringVarP(&hostLabels, "labels", "l", "", "labels selector, such as \"env=prod,role in (db,cache)\"")
+	hostCmd.Flags().StringSliceVarP(&hostLabelColumns, "label-columns", "L", []string{}, "label keys shown as columns")
+	hostCmd.Flags().BoolVar(&hostRefresh, "refresh", false, "run inventory plugins without cache")
 	rootCmd.AddCommand(hostCmd)
 }
@@ -0,0 +1,50 @@
+/*
+Copyright © 2026 PWZER <pwzergo@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/PWZER/dssh/config"
+)
+
+var hostEditConfig = &config.InventoryHostConfig{}
+
+// hostAddCmd represents the host add command
+var hostAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "add host to ~/.ssh/config",
+	Long:  "add Host block to ~/.ssh/config, tags are saved in the end of line comment",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return config.AddHost(args[0], hostEditConfig)
+	},
+}
+
+// addHostOptionFlags adds flags of the Host block options
+func addHostOptionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&hostEditConfig.HostName, "hostname", "H", "", "real host name or ip")
+	cmd.Flags().StringVarP(&hostEditConfig.User, "user", "u", "", "login username")
+	cmd.Flags().Uint16VarP(&hostEditConfig.Port, "port", "p", 0, "remote host port")
+	cmd.Flags().StringVarP(&hostEditConfig.ProxyJump, "jump", "j", "", "proxy jump host")
+	cmd.Flags().StringArrayVar(&hostEditConfig.IdentityFiles, "identity", []string{}, "identity file")
+}
+
+func init() {
+	addHostOptionFlags(hostAddCmd)
+	hostAddCmd.Flags().StringSliceVarP(&hostEditConfig.Tags, "tags", "t", []string{}, "host tags, such as \"web,prod\"")
+	hostCmd.AddCommand(hostAddCmd)
+}
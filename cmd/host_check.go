@@ -0,0 +1,49 @@
+/*
+Copyright © 2026 PWZER <pwzergo@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PWZER/dssh/config"
+)
+
+// hostCheckCmd represents the host check command
+var hostCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "check hosts in ~/.ssh/config",
+	Long:  "check jump cycles, unresolvable jumps, duplicate patterns, identity files, ports, tags comments and hosts without HostName",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		problems, err := config.CheckSSHConfig()
+		if err != nil {
+			return err
+		}
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("found %d problems", len(problems))
+		}
+		return nil
+	},
+}
+
+func init() {
+	hostCmd.AddCommand(hostCheckCmd)
+}
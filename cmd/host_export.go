@@ -0,0 +1,47 @@
+/*
+Copyright © 2026 PWZER <pwzergo@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PWZER/dssh/config"
+)
+
+var hostExportFormat string
+
+// hostExportCmd represents the host export command
+var hostExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export hosts as ansible inventory, json or csv",
+	Long:  "export the hosts filtered by \"--name\", \"--user\", \"--tags\" and \"--labels\" as ansible inventory, json or csv",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config.InventoryRefresh = hostRefresh
+		return config.ExportHosts(os.Stdout, hostExportFormat, hostName, hostUser, hostTags, hostLabels)
+	},
+}
+
+func init() {
+	hostExportCmd.Flags().StringVarP(&hostName, "name", "n", "", "host name")
+	hostExportCmd.Flags().StringVarP(&hostUser, "user", "u", "", "login username")
+	hostExportCmd.Flags().StringVarP(&hostTags, "tags", "t", "", "tags selector, such as \"web&prod\", \"db,!staging\" or \"region-*\"")
+	hostExportCmd.Flags().StringVarP(&hostLabels, "labels", "l", "", "labels selector, such as \"env=prod,role in (db,cache)\"")
+	hostExportCmd.Flags().BoolVar(&hostRefresh, "refresh", false, "run inventory plugins without cache")
+	hostExportCmd.Flags().StringVarP(&hostExportFormat, "format", "f", config.FormatAnsibleINI, "export format, allowed ( ansible-ini, ansible-yaml, json, csv )")
+	hostCmd.AddCommand(hostExportCmd)
+}
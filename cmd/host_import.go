@@ -0,0 +1,46 @@
+/*
+Copyright © 2026 PWZER <pwzergo@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PWZER/dssh/config"
+)
+
+var (
+	hostImportFormat string
+	hostImportAppend bool
+)
+
+// hostImportCmd represents the host import command
+var hostImportCmd = &cobra.Command{
+	Use:   "import <inventory>",
+	Short: "import ansible inventory as ssh config hosts",
+	Long:  "convert the ansible inventory to ssh config Host blocks, groups are saved as tags",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return config.ImportHosts(os.Stdout, args[0], hostImportFormat, hostImportAppend)
+	},
+}
+
+func init() {
+	hostImportCmd.Flags().StringVarP(&hostImportFormat, "format", "f", "", "inventory format, allowed ( ansible-ini, ansible-yaml, json ), default by file extension")
+	hostImportCmd.Flags().BoolVarP(&hostImportAppend, "append", "a", false, "append hosts to ~/.ssh/config instead of printing")
+	hostCmd.AddCommand(hostImportCmd)
+}
@@ -0,0 +1,37 @@
+/*
+Copyright © 2026 PWZER <pwzergo@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/PWZER/dssh/config"
+)
+
+// hostRmCmd represents the host rm command
+var hostRmCmd = &cobra.Command{
+	Use:   "rm <name>...",
+	Short: "remove hosts from ~/.ssh/config",
+	Long:  "remove Host blocks from ~/.ssh/config, only the name is removed if the block has other patterns",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return config.RemoveHosts(args...)
+	},
+}
+
+func init() {
+	hostCmd.AddCommand(hostRmCmd)
+}
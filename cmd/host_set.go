@@ -0,0 +1,41 @@
+/*
+Copyright © 2026 PWZER <pwzergo@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/PWZER/dssh/config"
+)
+
+var hostUnsetOptions []string
+
+// hostSetCmd represents the host set command
+var hostSetCmd = &cobra.Command{
+	Use:   "set <name>",
+	Short: "set host options in ~/.ssh/config",
+	Long:  "set or unset HostName, User, Port, ProxyJump and IdentityFile of the Host block in ~/.ssh/config",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return config.SetHost(args[0], hostEditConfig, hostUnsetOptions)
+	},
+}
+
+func init() {
+	addHostOptionFlags(hostSetCmd)
+	hostSetCmd.Flags().StringSliceVar(&hostUnsetOptions, "unset", []string{}, "options to remove, allowed ( HostName, User, Port, ProxyJump, IdentityFile )")
+	hostCmd.AddCommand(hostSetCmd)
+}
@@ -0,0 +1,49 @@
+/*
+Copyright © 2026 PWZER <pwzergo@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/PWZER/dssh/config"
+)
+
+// hostTagCmd represents the host tag command
+var hostTagCmd = &cobra.Command{
+	Use:   "tag <name> <tag>...",
+	Short: "add tags to host in ~/.ssh/config",
+	Long:  "add tags to the end of line comment of the Host block in ~/.ssh/config",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return config.TagHost(args[0], args[1:]...)
+	},
+}
+
+// hostUntagCmd represents the host untag command
+var hostUntagCmd = &cobra.Command{
+	Use:   "untag <name> <tag>...",
+	Short: "remove tags from host in ~/.ssh/config",
+	Long:  "remove tags from the end of line comment of the Host block in ~/.ssh/config",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return config.UntagHost(args[0], args[1:]...)
+	},
+}
+
+func init() {
+	hostCmd.AddCommand(hostTagCmd)
+	hostCmd.AddCommand(hostUntagCmd)
+}
@@ -0,0 +1,64 @@
+/*
+Copyright © 2026 PWZER <pwzergo@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PWZER/dssh/config"
+	"github.com/PWZER/dssh/ssh"
+)
+
+var (
+	keyscanConfig  = config.NewTaskConfig()
+	keyscanOptions = &ssh.KeyscanOptions{}
+)
+
+// keyscanCmd represents the keyscan command
+var keyscanCmd = &cobra.Command{
+	Use:   "keyscan [host]...",
+	Short: "scan host keys of hosts",
+	Long:  "connect to hosts through their jumps and print all offered host keys in known_hosts format, or add them to known_hosts with -w, changed keys are flagged",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 && (len(keyscanConfig.Tags) > 0 || len(keyscanConfig.Labels) > 0) {
+			return fmt.Errorf("host name and tags or labels can not be used together")
+		}
+		keyscanConfig.Targets = append(keyscanConfig.Targets, args...)
+		if err := keyscanConfig.InitTasks(); err != nil {
+			return err
+		}
+		return ssh.Keyscan(keyscanConfig, keyscanOptions)
+	},
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return config.GetHostNames(), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(keyscanCmd)
+
+	keyscanCmd.Flags().StringVarP(&keyscanConfig.Username, "user", "u", "", "username")
+	keyscanCmd.Flags().Uint16VarP(&keyscanConfig.Port, "port", "p", 0, "remote host port")
+	keyscanCmd.Flags().StringVarP(&keyscanConfig.ProxyJump, "jump", "j", "", "proxy jump host")
+	keyscanCmd.Flags().StringArrayVarP(&keyscanConfig.Tags, "tags", "t", []string{}, "tags selector, such as \"web&prod\", \"db,!staging\" or \"region-*\"")
+	keyscanCmd.Flags().StringArrayVarP(&keyscanConfig.Labels, "labels", "l", []string{}, "labels selector, such as \"env=prod,role in (db,cache)\"")
+	keyscanCmd.Flags().IntVarP(&keyscanConfig.Parallel, "parallel", "", 16, "max parallel scan hosts num")
+	keyscanCmd.Flags().DurationVar(&keyscanConfig.ConnectTimeout, "connect-timeout", 0, "connect timeout of each hop, default use ConnectTimeout in ssh config or 10s")
+	keyscanCmd.Flags().BoolVarP(&keyscanOptions.Write, "write", "w", false, "add new keys to UserKnownHostsFile instead of printing, changed keys are not replaced")
+	keyscanCmd.Flags().BoolVarP(&keyscanOptions.Hash, "hash", "H", false, "hash host names like ssh-keyscan -H")
+}
@@ -0,0 +1,137 @@
+/*
+Copyright © 2026 PWZER <pwzergo@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PWZER/dssh/config"
+	"github.com/PWZER/dssh/ssh"
+)
+
+var pinConnectTimeout time.Duration
+
+// knownHostsCmd represents the known-hosts command
+var knownHostsCmd = &cobra.Command{
+	Use:   "known-hosts",
+	Short: "manage host keys in known_hosts",
+	Long:  "list, remove and re-pin host keys in UserKnownHostsFile of ssh config, default is ~/.ssh/known_hosts",
+}
+
+// knownHostsListCmd represents the known-hosts list command
+var knownHostsListCmd = &cobra.Command{
+	Use:   "list [host]...",
+	Short: "list host keys, all keys in the default known_hosts if no host given",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var knownHosts []*ssh.KnownHost
+		if len(args) == 0 {
+			var err error
+			if knownHosts, err = ssh.ReadKnownHosts(config.DefaultKnownHostsFiles()); err != nil {
+				return err
+			}
+		}
+		for _, name := range args {
+			host, err := config.NewHost("", name, 0, "", nil)
+			if err != nil {
+				return err
+			}
+			matched, err := ssh.LookupKnownHosts(host)
+			if err != nil {
+				return err
+			}
+			knownHosts = append(knownHosts, matched...)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 12, 8, 4, ' ', 0)
+		fmt.Fprintln(w, "POSITION\tMARKER\tHOSTS\tTYPE\tFINGERPRINT\t")
+		for _, knownHost := range knownHosts {
+			hosts := make([]string, 0, len(knownHost.Hosts))
+			for _, pattern := range knownHost.Hosts {
+				if strings.HasPrefix(pattern, "|") {
+					pattern = "(hashed)"
+				}
+				hosts = append(hosts, pattern)
+			}
+			fmt.Fprintf(w, "%s:%d\t%s\t%s\t%s\t%s\t\n", knownHost.File, knownHost.Line, knownHost.Marker,
+				strings.Join(hosts, ","), knownHost.Key.Type(), knownHost.Fingerprint())
+		}
+		return w.Flush()
+	},
+}
+
+// knownHostsRmCmd represents the known-hosts rm command
+var knownHostsRmCmd = &cobra.Command{
+	Use:   "rm <host>...",
+	Short: "remove host keys, @cert-authority and @revoked lines are kept",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, name := range args {
+			host, err := config.NewHost("", name, 0, "", nil)
+			if err != nil {
+				return err
+			}
+			removed, err := ssh.RemoveKnownHost(host)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: %d keys removed\n", host.Name(), removed)
+		}
+		return nil
+	},
+}
+
+// knownHostsPinCmd represents the known-hosts pin command
+var knownHostsPinCmd = &cobra.Command{
+	Use:   "pin <host>...",
+	Short: "replace host keys with the current key of host",
+	Long:  "connect to host through its jumps, and replace host keys in known_hosts with the current key of host",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config.MatchExec = true
+		for _, name := range args {
+			host, err := config.NewHost("", name, 0, "", nil)
+			if err != nil {
+				return err
+			}
+			timeout := pinConnectTimeout
+			if timeout == 0 {
+				timeout = host.ConnectTimeout
+			}
+			key, err := ssh.PinHostKey(context.Background(), host, timeout)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: pinned %s %s\n", host.Name(), key.Type(), ssh.Fingerprint(key))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(knownHostsCmd)
+	knownHostsCmd.AddCommand(knownHostsListCmd)
+	knownHostsCmd.AddCommand(knownHostsRmCmd)
+	knownHostsCmd.AddCommand(knownHostsPinCmd)
+
+	knownHostsPinCmd.Flags().DurationVar(&pinConnectTimeout, "connect-timeout", 10*time.Second, "connect timeout of each hop")
+}
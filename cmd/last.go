@@ -0,0 +1,41 @@
+/*
+Copyright © 2026 PWZER <pwzergo@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/PWZER/dssh/ssh"
+)
+
+// lastCmd represents the last command
+var lastCmd = &cobra.Command{
+	Use:   "last",
+	Short: "show the result of the last run",
+	Long:  "show the result of the last run, use \"--retry-failed\" to rerun the failed hosts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		lastRun, err := ssh.LoadLastRun()
+		if err != nil {
+			return err
+		}
+		lastRun.Print()
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lastCmd)
+}
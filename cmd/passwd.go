@@ -16,12 +16,16 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/spf13/cobra"
 
+	"github.com/PWZER/dssh/config"
 	"github.com/PWZER/dssh/utils"
 )
 
 var pg *utils.PasswordGenerator
+var passwdVaultName string
 
 // passwdCmd represents the passwd command
 var passwdCmd = &cobra.Command{
@@ -29,7 +33,26 @@ var passwdCmd = &cobra.Command{
 	Short: "password generator",
 	Long:  "password generator",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return pg.GenPassword()
+		if passwdVaultName == "" {
+			return pg.GenPassword()
+		}
+
+		vault, err := openVault()
+		if err != nil {
+			return err
+		}
+		passwd, err := pg.Generate()
+		if err != nil {
+			return err
+		}
+		if err := vault.Set(config.VaultPassword, passwdVaultName, passwd); err != nil {
+			return err
+		}
+		if err := vault.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Password: %#v, saved in vault as %s\n", passwd, passwdVaultName)
+		return nil
 	},
 }
 
@@ -43,4 +66,5 @@ func init() {
 	passwdCmd.Flags().BoolVarP(&pg.DisabledUppercase, "disabledUppercase", "U", false, "disabled Uppercase")
 	passwdCmd.Flags().BoolVarP(&pg.DisabledPunctuation, "disabledPunctuation", "P", false, "disabled Punctuation")
 	passwdCmd.Flags().IntVarP(&pg.PasswordLength, "length", "l", 16, "password length")
+	passwdCmd.Flags().StringVar(&passwdVaultName, "vault", "", "save the password in vault as the host name or pattern")
 }
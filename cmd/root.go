@@ -16,6 +16,7 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -31,6 +32,7 @@ import (
 
 var cfgFile string
 var showVersion bool
+var retryFailed bool
 var taskConfig *config.TaskConfig = config.NewTaskConfig()
 
 // rootCmd represents the base command when called without any subcommands
@@ -49,14 +51,28 @@ var rootCmd = &cobra.Command{
 			return nil
 		}
 
-		if len(taskConfig.Targets) > 0 {
+		if retryFailed {
+			if len(args) > 0 || len(taskConfig.Targets) > 0 || len(taskConfig.Tags) > 0 || len(taskConfig.Labels) > 0 {
+				return fmt.Errorf("host name and retry failed can not be used together")
+			}
+			if taskConfig.Command != "" || taskConfig.Script != "" || taskConfig.Module != "" {
+				return fmt.Errorf("command and retry failed can not be used together")
+			}
+			lastRun, err := ssh.LoadLastRun()
+			if err != nil {
+				return err
+			}
+			if err := lastRun.ApplyFailed(taskConfig); err != nil {
+				return err
+			}
+		} else if len(taskConfig.Targets) > 0 {
 			if len(args) > 0 {
 				return fmt.Errorf("host name and args can not be used together")
 			}
-			if len(taskConfig.Tags) > 0 {
-				return fmt.Errorf("host name and tags can not be used together")
+			if len(taskConfig.Tags) > 0 || len(taskConfig.Labels) > 0 {
+				return fmt.Errorf("host name and tags or labels can not be used together")
 			}
-		} else if len(taskConfig.Tags) == 0 {
+		} else if len(taskConfig.Tags) == 0 && len(taskConfig.Labels) == 0 {
 			if len(args) == 0 {
 				return fmt.Errorf("host name is required")
 			}
@@ -80,6 +96,10 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println("[ERROR]", err)
+		var runErr *ssh.RunError
+		if errors.As(err, &runErr) {
+			os.Exit(runErr.ExitStatus())
+		}
 		os.Exit(1)
 	}
 }
@@ -88,6 +108,7 @@ func init() {
 	cobra.OnInitialize(initConfig)
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.dssh.yaml)")
+	rootCmd.PersistentFlags().StringArrayVarP(&config.SSHConfigPaths, "ssh-config", "F", []string{}, "ssh config file, default use sshConfigFiles in config or ~/.ssh/config")
 	rootCmd.PersistentFlags().Var(&logger.LogLevel, "log-level", "log level, allowed ( debug, info, warn, error, fatal, panic )")
 
 	// version
@@ -100,13 +121,35 @@ func init() {
 	rootCmd.Flags().StringVarP(&taskConfig.ProxyJump, "jump", "j", "", "proxy jump host")
 	rootCmd.Flags().StringArrayVar(&taskConfig.IdentityFiles, "identity", []string{}, "identity file")
 	rootCmd.Flags().IntVarP(&taskConfig.Parallel, "parallel", "", 1, "max parallel run tasks num")
-	rootCmd.Flags().StringArrayVarP(&taskConfig.Tags, "tags", "t", []string{}, "tags filter")
+	rootCmd.Flags().StringArrayVarP(&taskConfig.Tags, "tags", "t", []string{}, "tags selector, such as \"web&prod\", \"db,!staging\" or \"region-*\"")
+	rootCmd.Flags().StringArrayVarP(&taskConfig.Labels, "labels", "l", []string{}, "labels selector, such as \"env=prod,role in (db,cache)\"")
 	rootCmd.Flags().BoolVarP(&taskConfig.FailedContinue, "force", "f", false, "force run when failed")
+	rootCmd.Flags().StringVar(&taskConfig.Batch, "batch", "", "run tasks in rolling batches, such as \"10%\" or \"1,5,25%\"")
+	rootCmd.Flags().DurationVar(&taskConfig.BatchPause, "batch-pause", 0, "pause duration between batches")
+	rootCmd.Flags().BoolVar(&taskConfig.BatchConfirm, "batch-confirm", false, "confirm before running the next batch")
+	rootCmd.Flags().BoolVar(&taskConfig.ReusePassword, "reuse-password", false, "try the password entered once for hosts of the same user and tag or jump before asking")
+	rootCmd.Flags().BoolVar(&taskConfig.BatchMode, "batch-mode", false, "never prompt for password, passphrase or host key, such hosts fail as auth-failed, like BatchMode in ssh config")
+	rootCmd.Flags().StringVar(&taskConfig.MaxFail, "max-fail", "", "abort remaining tasks when failed hosts reach this count or percent, such as \"5\" or \"5%\"")
+	rootCmd.Flags().DurationVar(&taskConfig.Timeout, "timeout", 0, "remote command timeout, such as \"30s\" or \"5m\"")
+	rootCmd.Flags().DurationVar(&taskConfig.ConnectTimeout, "connect-timeout", 0, "connect timeout of each hop, default use ConnectTimeout in ssh config")
+	rootCmd.Flags().IntVar(&taskConfig.Retry.Attempts, "connect-attempts", taskConfig.Retry.Attempts, "connect attempts of each hop")
+	rootCmd.Flags().DurationVar(&taskConfig.Retry.Backoff, "connect-backoff", taskConfig.Retry.Backoff, "initial backoff between connect attempts, doubled after each attempt")
+	rootCmd.Flags().StringSliceVar(&taskConfig.Retry.RetryOn, "retry-on", taskConfig.Retry.RetryOn, "connect errors to retry, allowed ( timeout, refused, reset, unreachable, handshake, auth )")
+	rootCmd.Flags().BoolVar(&taskConfig.Preflight, "preflight", false, "probe all hosts before running and skip the unreachable hosts")
+	rootCmd.Flags().BoolVar(&retryFailed, "retry-failed", false, "rerun the last run on the hosts which did not succeed")
 
 	// remote command
 	rootCmd.Flags().StringVarP(&taskConfig.Command, "command", "c", "", "remote run command")
 	rootCmd.Flags().StringVarP(&taskConfig.Script, "script", "s", "", "remote run script")
 	rootCmd.Flags().StringVarP(&taskConfig.Module, "module", "m", "", "remote run module")
+	rootCmd.Flags().BoolVarP(&taskConfig.Template, "template", "T", false, "render command, script and module as go template with host variables, such as {{.HostName}}")
+	rootCmd.Flags().StringToStringVar(&taskConfig.Vars, "var", map[string]string{}, "extra template variables, such as --var key=value")
+	rootCmd.Flags().StringVarP(&taskConfig.Output, "output", "o", config.OutputStream, "remote output mode, allowed ( stream, prefix, buffer, group )")
+	rootCmd.Flags().StringVar(&taskConfig.OutputDir, "output-dir", "", "save remote stdout/stderr to <host>.stdout/<host>.stderr in this dir, <host>.<index> for repeated hosts")
+
+	// report
+	rootCmd.Flags().StringVar(&taskConfig.Report, "report", config.ReportTable, "end of run report format, allowed ( table, json, none )")
+	rootCmd.Flags().StringVar(&taskConfig.ReportFile, "report-file", "", "write report to file instead of stderr")
 
 	// remote proxy
 	rootCmd.Flags().StringVar(&taskConfig.RemoteListen, "remote-listen", "", "remote proxy listen address")
@@ -0,0 +1,208 @@
+/*
+Copyright © 2026 PWZER <pwzergo@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/PWZER/dssh/config"
+)
+
+var vaultPassphrase bool
+
+// vaultCmd represents the vault command
+var vaultCmd = &cobra.Command{
+	Use:   "vault",
+	Short: "manage passwords and key passphrases in encrypted vault",
+	Long: `manage passwords of hosts and passphrases of identity files in the vault encrypted by scrypt and NaCl secretbox,
+the vault is unlocked once when a password or passphrase is needed, the vault password is read from
+environment variable DSSH_VAULT_PASSWORD or prompted. Passwords are saved by host name or pattern,
+such as "web-01", "deploy@web-01" or "web-*", passphrases are saved by identity file with "--passphrase"`,
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// readSecret reads the secret without echo from terminal, or a line from stdin if it's not a terminal
+func readSecret(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := stdinReader.ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("read %s failed: %v", strings.TrimRight(prompt, ": "), err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	secret, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(secret), err
+}
+
+// openVault unlocks the vault with environment variable or the prompted password
+func openVault() (*config.Vault, error) {
+	if !config.VaultExists() {
+		return nil, config.ErrVaultNotFound
+	}
+	password := os.Getenv(config.VaultPasswordEnv)
+	if password == "" {
+		var err error
+		if password, err = readSecret("Enter Vault Password: "); err != nil {
+			return nil, err
+		}
+	}
+	return config.OpenVault([]byte(password))
+}
+
+func vaultKind() string {
+	if vaultPassphrase {
+		return config.VaultPassphrase
+	}
+	return config.VaultPassword
+}
+
+// vaultInitCmd represents the vault init command
+var vaultInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "create an empty vault",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if config.VaultExists() {
+			return fmt.Errorf("vault %s already exists", config.VaultPath())
+		}
+		password := os.Getenv(config.VaultPasswordEnv)
+		if password == "" {
+			var err error
+			if password, err = readSecret("New Vault Password: "); err != nil {
+				return err
+			}
+			confirm, err := readSecret("Confirm Vault Password: ")
+			if err != nil {
+				return err
+			}
+			if password != confirm {
+				return fmt.Errorf("vault passwords do not match")
+			}
+		}
+		if _, err := config.InitVault([]byte(password)); err != nil {
+			return err
+		}
+		fmt.Printf("vault %s created\n", config.VaultPath())
+		return nil
+	},
+}
+
+// vaultSetCmd represents the vault set command
+var vaultSetCmd = &cobra.Command{
+	Use:   "set <name>",
+	Short: "set the password of host or pattern, or the passphrase of identity file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vault, err := openVault()
+		if err != nil {
+			return err
+		}
+		secret, err := readSecret(fmt.Sprintf("Enter %s of %s: ", vaultKind(), args[0]))
+		if err != nil {
+			return err
+		}
+		if err := vault.Set(vaultKind(), args[0], secret); err != nil {
+			return err
+		}
+		return vault.Save()
+	},
+}
+
+// vaultGetCmd represents the vault get command
+var vaultGetCmd = &cobra.Command{
+	Use:   "get <name>",
+	Short: "print the password of host or pattern, or the passphrase of identity file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vault, err := openVault()
+		if err != nil {
+			return err
+		}
+		secret, ok := vault.Get(vaultKind(), args[0])
+		if !ok && !vaultPassphrase {
+			// the name is a host, lookup by host name or pattern as connecting
+			if host, err := config.NewHost("", args[0], 0, "", nil); err == nil {
+				secret, ok = vault.HostPassword(host)
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s of %s not found in vault", vaultKind(), args[0])
+		}
+		fmt.Println(secret)
+		return nil
+	},
+}
+
+// vaultListCmd represents the vault list command
+var vaultListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list names of passwords and passphrases",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vault, err := openVault()
+		if err != nil {
+			return err
+		}
+		for _, kind := range []string{config.VaultPassword, config.VaultPassphrase} {
+			for _, name := range vault.Names(kind) {
+				fmt.Printf("%-12s%s\n", kind, name)
+			}
+		}
+		return nil
+	},
+}
+
+// vaultRmCmd represents the vault rm command
+var vaultRmCmd = &cobra.Command{
+	Use:   "rm <name>...",
+	Short: "remove passwords of hosts or patterns, or passphrases of identity files",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vault, err := openVault()
+		if err != nil {
+			return err
+		}
+		for _, name := range args {
+			if err := vault.Remove(vaultKind(), name); err != nil {
+				return err
+			}
+		}
+		return vault.Save()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(vaultCmd)
+	vaultCmd.AddCommand(vaultInitCmd)
+	vaultCmd.AddCommand(vaultSetCmd)
+	vaultCmd.AddCommand(vaultGetCmd)
+	vaultCmd.AddCommand(vaultListCmd)
+	vaultCmd.AddCommand(vaultRmCmd)
+
+	for _, command := range []*cobra.Command{vaultSetCmd, vaultGetCmd, vaultRmCmd} {
+		command.Flags().BoolVar(&vaultPassphrase, "passphrase", false, "the name is an identity file, its passphrase is saved")
+	}
+}
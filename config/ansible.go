@@ -0,0 +1,470 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+type ansibleGroup struct {
+	Hosts    []string       `json:"hosts"`
+	Children []string       `json:"children"`
+	Vars     map[string]any `json:"vars"`
+}
+
+// ansibleInventory is the common model of ansible inventories in JSON, INI and YAML
+type ansibleInventory struct {
+	HostVars map[string]map[string]any
+	Groups   map[string]*ansibleGroup
+}
+
+func newAnsibleInventory() *ansibleInventory {
+	return &ansibleInventory{
+		HostVars: make(map[string]map[string]any),
+		Groups:   make(map[string]*ansibleGroup),
+	}
+}
+
+func (a *ansibleInventory) group(name string) *ansibleGroup {
+	group, ok := a.Groups[name]
+	if !ok {
+		group = &ansibleGroup{Vars: make(map[string]any)}
+		a.Groups[name] = group
+	}
+	if group.Vars == nil {
+		group.Vars = make(map[string]any)
+	}
+	return group
+}
+
+func (a *ansibleInventory) addHost(groupName, name string, vars map[string]any) {
+	group := a.group(groupName)
+	if !slices.Contains(group.Hosts, name) {
+		group.Hosts = append(group.Hosts, name)
+	}
+	if _, ok := a.HostVars[name]; !ok {
+		a.HostVars[name] = make(map[string]any)
+	}
+	maps.Copy(a.HostVars[name], vars)
+}
+
+// inventory converts to dssh inventory, groups "all" and "ungrouped" are not used as tags
+func (a *ansibleInventory) inventory() (*Inventory, error) {
+	inventory := &Inventory{
+		Hosts:  make(map[string]*InventoryHostConfig),
+		Groups: make(map[string]*InventoryGroup),
+	}
+	for name, vars := range a.HostVars {
+		inventory.Hosts[name] = ansibleHostConfig(vars)
+	}
+
+	for name, group := range a.Groups {
+		if name == "all" || name == "ungrouped" {
+			for _, host := range group.Hosts {
+				if _, ok := inventory.Hosts[host]; !ok {
+					inventory.Hosts[host] = &InventoryHostConfig{}
+				}
+			}
+			if name == "all" {
+				inventory.Defaults = *ansibleHostConfig(group.Vars)
+			}
+			continue
+		}
+
+		inventory.Groups[name] = &InventoryGroup{
+			InventoryHostConfig: *ansibleHostConfig(group.Vars),
+			Hosts:               group.Hosts,
+		}
+	}
+
+	// children may refer to "ungrouped" or undefined groups
+	for name, group := range a.Groups {
+		if _, ok := inventory.Groups[name]; !ok {
+			continue
+		}
+		for _, child := range group.Children {
+			if _, ok := inventory.Groups[child]; ok {
+				inventory.Groups[name].Children = append(inventory.Groups[name].Children, child)
+			}
+		}
+	}
+
+	if err := inventory.validate(); err != nil {
+		return nil, err
+	}
+	return inventory, nil
+}
+
+// parseAnsibleJSON parses the output of ansible dynamic inventory with "--list"
+func parseAnsibleJSON(raw map[string]json.RawMessage) (*Inventory, error) {
+	a := newAnsibleInventory()
+	if data, ok := raw["_meta"]; ok {
+		var meta struct {
+			HostVars map[string]map[string]any `json:"hostvars"`
+		}
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil, fmt.Errorf("invalid _meta: %v", err)
+		}
+		for name, vars := range meta.HostVars {
+			a.HostVars[name] = vars
+		}
+	}
+
+	for name, data := range raw {
+		if name == "_meta" {
+			continue
+		}
+
+		group := a.group(name)
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+			if err := json.Unmarshal(data, &group.Hosts); err != nil {
+				return nil, fmt.Errorf("invalid group %s: %v", name, err)
+			}
+		} else if err := json.Unmarshal(data, group); err != nil {
+			return nil, fmt.Errorf("invalid group %s: %v", name, err)
+		}
+	}
+	return a.inventory()
+}
+
+type ansibleYAMLGroup struct {
+	Hosts    map[string]map[string]any    `yaml:"hosts"`
+	Vars     map[string]any               `yaml:"vars"`
+	Children map[string]*ansibleYAMLGroup `yaml:"children"`
+}
+
+func (a *ansibleInventory) walkYAMLGroup(name string, yamlGroup *ansibleYAMLGroup) {
+	group := a.group(name)
+	if yamlGroup == nil {
+		return
+	}
+	for host, vars := range yamlGroup.Hosts {
+		a.addHost(name, host, vars)
+	}
+	maps.Copy(group.Vars, yamlGroup.Vars)
+	for child, childGroup := range yamlGroup.Children {
+		if !slices.Contains(group.Children, child) {
+			group.Children = append(group.Children, child)
+		}
+		a.walkYAMLGroup(child, childGroup)
+	}
+}
+
+// parseAnsibleYAML parses the ansible inventory in YAML format
+func parseAnsibleYAML(data []byte) (*Inventory, error) {
+	groups := make(map[string]*ansibleYAMLGroup)
+	if err := yaml.Unmarshal(data, &groups); err != nil {
+		return nil, err
+	}
+	a := newAnsibleInventory()
+	for name, group := range groups {
+		a.walkYAMLGroup(name, group)
+	}
+	return a.inventory()
+}
+
+var (
+	iniSectionRegex = regexp.MustCompile(`^\[([^:\]]+)(?::(vars|children))?\]$`)
+	hostRangeRegex  = regexp.MustCompile(`\[([0-9]+|[a-z]):([0-9]+|[a-z])\]`)
+)
+
+// splitFields splits the line by spaces, except in quotes. Like shlex, "\"" and "\\" are escaped in double quotes
+func splitFields(line string) (fields []string) {
+	var field strings.Builder
+	var quote rune
+	inField, escaped := false, false
+	for _, r := range line {
+		switch {
+		case escaped:
+			if r != '"' && r != '\\' {
+				field.WriteRune('\\')
+			}
+			field.WriteRune(r)
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			field.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// expandHostRange expands the ansible host pattern, such as "web-[01:03]" or "db-[a:c]"
+func expandHostRange(pattern string) ([]string, error) {
+	loc := hostRangeRegex.FindStringSubmatchIndex(pattern)
+	if loc == nil {
+		return []string{pattern}, nil
+	}
+	prefix, suffix := pattern[:loc[0]], pattern[loc[1]:]
+	start, end := pattern[loc[2]:loc[3]], pattern[loc[4]:loc[5]]
+
+	values := make([]string, 0)
+	if startNum, err := strconv.Atoi(start); err == nil {
+		endNum, err := strconv.Atoi(end)
+		if err != nil || endNum < startNum {
+			return nil, fmt.Errorf("invalid host range: %s", pattern)
+		}
+		for i := startNum; i <= endNum; i++ {
+			value := strconv.Itoa(i)
+			if len(start) > 1 && strings.HasPrefix(start, "0") {
+				value = fmt.Sprintf("%0*d", len(start), i)
+			}
+			values = append(values, value)
+		}
+	} else {
+		if len(end) != 1 || end[0] < start[0] {
+			return nil, fmt.Errorf("invalid host range: %s", pattern)
+		}
+		for c := start[0]; c <= end[0]; c++ {
+			values = append(values, string(c))
+		}
+	}
+
+	hosts := make([]string, 0)
+	for _, value := range values {
+		expanded, err := expandHostRange(prefix + value + suffix)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, expanded...)
+	}
+	return hosts, nil
+}
+
+func parseKeyValues(fields []string) (map[string]any, error) {
+	vars := make(map[string]any)
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid variable: %s", field)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// parseAnsibleINI parses the ansible inventory in INI format
+func parseAnsibleINI(reader io.Reader) (*Inventory, error) {
+	a := newAnsibleInventory()
+	section, kind := "ungrouped", ""
+
+	scanner := bufio.NewScanner(reader)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if match := iniSectionRegex.FindStringSubmatch(line); match != nil {
+			section, kind = match[1], match[2]
+			a.group(section)
+			continue
+		}
+
+		fields := splitFields(line)
+		switch kind {
+		case "vars":
+			vars, err := parseKeyValues(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			maps.Copy(a.group(section).Vars, vars)
+		case "children":
+			group := a.group(section)
+			if !slices.Contains(group.Children, fields[0]) {
+				group.Children = append(group.Children, fields[0])
+			}
+			a.group(fields[0])
+		default:
+			vars, err := parseKeyValues(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			hosts, err := expandHostRange(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			for _, host := range hosts {
+				a.addHost(section, host, vars)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return a.inventory()
+}
+
+var ansibleProxyJumpRegex = regexp.MustCompile(`(?:-J\s*|ProxyJump=)([^\s'"]+)`)
+
+// ansibleHostConfig converts ansible connection variables, others are kept as vars
+func ansibleHostConfig(vars map[string]any) *InventoryHostConfig {
+	hostConfig := &InventoryHostConfig{Vars: make(map[string]string)}
+	for key, value := range vars {
+		str := ansibleVarString(value)
+		switch key {
+		case "ansible_host", "ansible_ssh_host":
+			hostConfig.HostName = str
+		case "ansible_user", "ansible_ssh_user":
+			hostConfig.User = str
+		case "ansible_port", "ansible_ssh_port":
+			if port, err := strconv.ParseUint(str, 10, 16); err == nil {
+				hostConfig.Port = uint16(port)
+			}
+		case "ansible_ssh_private_key_file":
+			hostConfig.IdentityFiles = []string{str}
+		case "ansible_ssh_common_args", "ansible_ssh_extra_args":
+			if match := ansibleProxyJumpRegex.FindStringSubmatch(str); len(match) > 1 {
+				hostConfig.ProxyJump = match[1]
+			}
+		case "dssh_labels":
+			if labels, err := ParseLabels(str); err == nil {
+				hostConfig.Labels = labels
+			}
+		default:
+			if strings.HasPrefix(key, "ansible_") {
+				continue
+			}
+			hostConfig.Vars[key] = str
+		}
+	}
+	return hostConfig
+}
+
+func ansibleVarString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	case map[string]any, []any:
+		if data, err := json.Marshal(v); err == nil {
+			return string(data)
+		}
+		return fmt.Sprint(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ansibleHostVars returns the ansible variables of host, labels are kept in "dssh_labels"
+func ansibleHostVars(host *Host) map[string]string {
+	vars := make(map[string]string)
+	maps.Copy(vars, host.Vars)
+	vars["ansible_host"] = host.HostName
+	if host.Username != "" {
+		vars["ansible_user"] = host.Username
+	}
+	if host.Port != 0 {
+		vars["ansible_port"] = strconv.Itoa(int(host.Port))
+	}
+	if len(host.IdentityFiles) > 0 {
+		vars["ansible_ssh_private_key_file"] = host.IdentityFiles[0]
+	}
+	if host.ProxyJump != "" {
+		vars["ansible_ssh_common_args"] = "-o ProxyJump=" + host.ProxyJump
+	}
+	if len(host.Labels) > 0 {
+		vars["dssh_labels"] = host.LabelsString()
+	}
+	return vars
+}
+
+// hostGroups returns the hosts of each tag
+func hostGroups(hosts []*Host) map[string][]string {
+	groups := make(map[string][]string)
+	for _, host := range hosts {
+		for _, tag := range host.TagList {
+			groups[tag] = append(groups[tag], host.Name())
+		}
+	}
+	return groups
+}
+
+// quoteINIValue quotes the value with single quotes, or double quotes if it has single quotes
+func quoteINIValue(value string) string {
+	if !strings.ContainsAny(value, " \t'\"\\") {
+		return value
+	}
+	if !strings.Contains(value, "'") {
+		return "'" + value + "'"
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func writeAnsibleINI(w io.Writer, hosts []*Host) error {
+	for _, host := range hosts {
+		vars := ansibleHostVars(host)
+		line := host.Name()
+		for _, key := range slices.Sorted(maps.Keys(vars)) {
+			line += fmt.Sprintf(" %s=%s", key, quoteINIValue(vars[key]))
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	groups := hostGroups(hosts)
+	for _, group := range slices.Sorted(maps.Keys(groups)) {
+		if _, err := fmt.Fprintf(w, "\n[%s]\n%s\n", group, strings.Join(groups[group], "\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeAnsibleYAML(w io.Writer, hosts []*Host) error {
+	allHosts := make(map[string]map[string]string)
+	for _, host := range hosts {
+		allHosts[host.Name()] = ansibleHostVars(host)
+	}
+
+	children := make(map[string]any)
+	for group, names := range hostGroups(hosts) {
+		groupHosts := make(map[string]map[string]string)
+		for _, name := range names {
+			groupHosts[name] = map[string]string{}
+		}
+		children[group] = map[string]any{"hosts": groupHosts}
+	}
+
+	all := map[string]any{"hosts": allHosts}
+	if len(children) > 0 {
+		all["children"] = children
+	}
+	data, err := yaml.Marshal(map[string]any{"all": all})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
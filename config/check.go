@@ -0,0 +1,196 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+)
+
+// Problem is a finding of CheckSSHConfig at the file and line
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+var commentTagsLooseRegex = regexp.MustCompile(`\btags\b\s*[:=]?\s*(\S*)`)
+
+// checkComment checks the tags and labels in end of line comment
+func checkComment(comment string) (messages []string) {
+	if match := commentTagsLooseRegex.FindStringSubmatch(comment); match != nil {
+		strict := commentTagsRegex.FindStringSubmatch(comment)
+		if strict == nil || strict[0] != match[0] || validateTags(strings.Split(strict[1], ",")) != nil {
+			messages = append(messages, fmt.Sprintf("malformed tags comment %q, such as \"tags:web,prod\"", match[0]))
+		}
+	}
+	if strings.Contains(comment, "labels") {
+		match := commentLabelsRegex.FindStringSubmatch(comment)
+		if match == nil {
+			messages = append(messages, "malformed labels comment, such as \"labels: env=prod,role=db\"")
+		} else if _, err := ParseLabels(match[1]); err != nil {
+			messages = append(messages, fmt.Sprintf("malformed labels comment: %v", err))
+		}
+	}
+	return messages
+}
+
+// resolvable reports whether the jump is a host in ssh config or inventory, or a resolvable address
+func resolvable(alias, user string) bool {
+	if sshConfigGet(alias, user, "HostName") != "" {
+		return true
+	}
+	if inventories, err := loadInventories(); err == nil {
+		for _, inventory := range inventories {
+			if inventory.has(alias) {
+				return true
+			}
+		}
+	}
+	_, err := net.LookupHost(alias)
+	return err == nil
+}
+
+// checkJumps checks each jump of ProxyJump value is valid and resolvable
+func checkJumps(value string) (messages []string) {
+	if strings.EqualFold(value, "none") {
+		return nil
+	}
+	for _, jump := range strings.Split(value, ",") {
+		jump = strings.TrimPrefix(strings.TrimSpace(jump), "ssh://")
+		if jump == "" || strings.Contains(jump, "%") {
+			continue
+		}
+		jumpHost, err := parseHost("", jump, 0, "", nil)
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("invalid ProxyJump %s: %v", jump, err))
+			continue
+		}
+		if !resolvable(jumpHost.HostName, jumpHost.Username) {
+			messages = append(messages, fmt.Sprintf("ProxyJump %s is not a host in ssh config or inventory, and can't be resolved", jump))
+		}
+	}
+	return messages
+}
+
+// checkIdentityFile checks the identity file exists and is readable
+func checkIdentityFile(host *Host, value string) string {
+	if strings.EqualFold(value, "none") {
+		return ""
+	}
+	path := host.expandPath(value)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return fmt.Sprintf("identity file %s not found", path)
+	}
+	if err != nil {
+		return fmt.Sprintf("identity file %s is unreadable: %v", path, err)
+	}
+	file.Close()
+	return ""
+}
+
+// CheckSSHConfig checks the user ssh config files, such as jump cycles, unresolvable jumps, duplicate patterns,
+// missing identity files, invalid ports, malformed tags comments and hosts without HostName
+func CheckSSHConfig() (problems []Problem, err error) {
+	userConfig, _, err := loadSSHConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	report := func(file string, line int, message string) {
+		problem := Problem{File: file, Line: line, Message: message}
+		if file == "" || seen[problem.String()] {
+			return
+		}
+		seen[problem.String()] = true
+		problems = append(problems, problem)
+	}
+
+	blocks := make(map[string]bool)
+	definitions := make(map[string]string)
+	for index, hostConfig := range userConfig.config.Hosts {
+		file, line := userConfig.hostPosition(index)
+		position := fmt.Sprintf("%s:%d", file, line)
+		isHost := file != "" && !userConfig.isMatchBlock(index)
+		if isHost && blocks[position] {
+			continue // included more than once
+		}
+		blocks[position] = true
+
+		host := &Host{}
+		if isHost {
+			for _, name := range userConfig.patterns(index) {
+				if strings.ContainsAny(name, "*!?") {
+					continue
+				}
+				if host.HostName == "" {
+					host.Patterns, host.HostName = []string{name}, name
+				}
+				if first, ok := definitions[name]; ok {
+					report(file, line, fmt.Sprintf("duplicate pattern %s, first defined at %s", name, first))
+				} else {
+					definitions[name] = position
+				}
+			}
+			for _, message := range checkComment(hostConfig.EOLComment) {
+				report(file, line, message)
+			}
+		}
+
+		hasHostName := false
+		for _, node := range hostConfig.Nodes {
+			kv, ok := node.(*ssh_config.KV)
+			if !ok {
+				continue
+			}
+			kvFile, kvLine := userConfig.Position(kv.Pos().Line)
+			switch strings.ToLower(kv.Key) {
+			case "hostname":
+				hasHostName = true
+			case "port":
+				if port, err := strconv.Atoi(kv.Value); err != nil || port <= 0 || port >= 65536 {
+					report(kvFile, kvLine, fmt.Sprintf("invalid port %s", kv.Value))
+				}
+			case "identityfile":
+				if host.HostName == "" && strings.Contains(kv.Value, "%") {
+					continue // tokens of the pattern block are expanded for each host
+				}
+				if message := checkIdentityFile(host, kv.Value); message != "" {
+					report(kvFile, kvLine, message)
+				}
+			case "proxyjump":
+				for _, message := range checkJumps(kv.Value) {
+					report(kvFile, kvLine, message)
+				}
+			}
+		}
+
+		if !isHost || host.HostName == "" {
+			continue
+		}
+
+		// the hosts without HostName are not listed, they are used as patterns
+		onlyNames := !slices.ContainsFunc(userConfig.patterns(index), func(pattern string) bool {
+			return strings.ContainsAny(pattern, "*!?")
+		})
+		if onlyNames && !hasHostName && sshConfigGet(host.HostName, "", "HostName") == "" {
+			report(file, line, fmt.Sprintf("host %s has no HostName, it's not listed by \"ds host\"", host.HostName))
+		}
+
+		if _, err := NewHost("", host.HostName, 0, "", nil); err != nil {
+			report(file, line, err.Error())
+		}
+	}
+	return problems, nil
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/PWZER/dssh/logger"
 	homedir "github.com/mitchellh/go-homedir"
@@ -17,6 +18,25 @@ import (
 type ConfigType struct {
 	ModulesDir  string `yaml:"modulesDir,omitempty"`
 	SSHAuthSock string `yaml:"sshAuthSock,omitempty"`
+	StateDir    string `yaml:"stateDir,omitempty"`
+
+	// ssh config files, default is ~/.ssh/config, Include directives in them are followed
+	SSHConfigFiles []string `yaml:"sshConfigFiles,omitempty"`
+
+	// standalone inventory files, hosts in them are merged with ~/.ssh/config
+	Inventory []string `yaml:"inventory,omitempty"`
+	// dynamic inventory executables, which print hosts in JSON with "--list"
+	InventoryPlugins  []string      `yaml:"inventoryPlugins,omitempty"`
+	InventoryCacheTTL time.Duration `yaml:"inventoryCacheTTL,omitempty"`
+
+	// encrypted vault of passwords and key passphrases, default is ~/.dssh/vault
+	VaultFile string `yaml:"vaultFile,omitempty"`
+	// commands printing passwords and passphrases, the key is host pattern, such as "web-*",
+	// the command is rendered as template, such as "pass show infra/{{host}}"
+	PasswordCommands map[string]string `yaml:"passwordCommands,omitempty"`
+
+	// template variables of hosts, the key is host pattern, such as "web-*"
+	HostVars map[string]map[string]string `yaml:"hostVars,omitempty"`
 }
 
 var Config = &ConfigType{}
@@ -30,6 +50,18 @@ func getSSHAuthSock() (sock string) {
 	return sock
 }
 
+// StateDir returns the directory to save dssh runtime states, such as the last run result
+func StateDir() string {
+	if Config.StateDir != "" {
+		return Config.StateDir
+	}
+	if stateHome := os.Getenv("XDG_STATE_HOME"); stateHome != "" {
+		return path.Join(stateHome, "dssh")
+	}
+	homeDir, _ := homedir.Dir()
+	return path.Join(homeDir, ".local", "state", "dssh")
+}
+
 func LoadConfig() error {
 	if err := viper.Unmarshal(Config); err != nil {
 		return err
@@ -41,8 +73,8 @@ func LoadConfig() error {
 	return nil
 }
 
-func FilteredHosts(name string, user string, tags string) (hosts []*Host, err error) {
-	hosts, err = GetHostsFromSSHConfig()
+func FilteredHosts(name string, user string, tags string, labels string) (hosts []*Host, err error) {
+	hosts, err = GetHosts()
 	if err != nil {
 		return nil, err
 	}
@@ -70,47 +102,70 @@ func FilteredHosts(name string, user string, tags string) (hosts []*Host, err er
 	}
 
 	if tags != "" {
-		tagsMap := make(map[string]bool)
-		for _, tag := range strings.Split(tags, ",") {
-			tagsMap[tag] = true
+		selector, err := ParseTagSelector(tags)
+		if err != nil {
+			return nil, err
 		}
 
 		newHosts := make([]*Host, 0)
 		for _, host := range hosts {
-			for _, tag := range host.TagList {
-				if tagsMap[tag] {
-					newHosts = append(newHosts, host)
-					break
-				}
+			if host.MatchTags(selector) {
+				newHosts = append(newHosts, host)
 			}
 		}
 		logger.Debugf("Filtered hosts by tags: %+#v", newHosts)
 		hosts = newHosts
 	}
 
+	if labels != "" {
+		selector, err := ParseLabelSelector(labels)
+		if err != nil {
+			return nil, err
+		}
+
+		newHosts := make([]*Host, 0)
+		for _, host := range hosts {
+			if host.MatchLabels(selector) {
+				newHosts = append(newHosts, host)
+			}
+		}
+		logger.Debugf("Filtered hosts by labels: %+#v", newHosts)
+		hosts = newHosts
+	}
+
 	return hosts, err
 }
 
-func ListConfigHosts(name string, user string, tags string) error {
-	w := tabwriter.NewWriter(os.Stdout, 12, 8, 4, ' ', 0)
-	fmt.Fprintln(w, "PATTERNS\tHOST\tUSER\tPORT\tJUMP\tTAGS\t")
-	hosts, err := FilteredHosts(name, user, tags)
+// ListConfigHosts lists filtered hosts, labelColumns are label keys shown as extra columns
+func ListConfigHosts(name string, user string, tags string, labels string, labelColumns []string) error {
+	hosts, err := FilteredHosts(name, user, tags, labels)
 	if err != nil {
 		return err
 	}
+
+	w := tabwriter.NewWriter(os.Stdout, 12, 8, 4, ' ', 0)
+	header := "PATTERNS\tHOST\tUSER\tPORT\tJUMP\tTAGS\tLABELS\t"
+	for _, key := range labelColumns {
+		header += strings.ToUpper(key) + "\t"
+	}
+	fmt.Fprintln(w, header)
 	for _, host := range hosts {
 		port := ""
 		if host.Port != 0 {
 			port = strconv.Itoa(int(host.Port))
 		}
-		row := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t",
+		row := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t",
 			strings.Join(host.Patterns, ","),
 			host.HostName,
 			host.Username,
 			port,
 			host.ProxyJump,
 			strings.Join(host.TagList, ","),
+			host.LabelsString(),
 		)
+		for _, key := range labelColumns {
+			row += host.Labels[key] + "\t"
+		}
 		fmt.Fprintln(w, row)
 	}
 	w.Flush()
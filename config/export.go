@@ -0,0 +1,207 @@
+package config
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/PWZER/dssh/logger"
+)
+
+const (
+	FormatAnsibleINI  = "ansible-ini"
+	FormatAnsibleYAML = "ansible-yaml"
+	FormatJSON        = "json"
+	FormatCSV         = "csv"
+)
+
+// writeJSON writes hosts as dssh inventory, it can be used as inventory file or plugin output
+func writeJSON(w io.Writer, hosts []*Host) error {
+	inventory := struct {
+		Hosts map[string]*InventoryHostConfig `json:"hosts"`
+	}{Hosts: make(map[string]*InventoryHostConfig)}
+	for _, host := range hosts {
+		inventory.Hosts[host.Name()] = &InventoryHostConfig{
+			HostName:      host.HostName,
+			User:          host.Username,
+			Port:          host.Port,
+			ProxyJump:     host.ProxyJump,
+			IdentityFiles: host.IdentityFiles,
+			Tags:          host.TagList,
+			Labels:        host.Labels,
+			Vars:          host.Vars,
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(inventory)
+}
+
+func writeCSV(w io.Writer, hosts []*Host) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"name", "hostname", "user", "port", "jump", "identity_files", "tags", "labels"})
+	for _, host := range hosts {
+		port := ""
+		if host.Port != 0 {
+			port = strconv.Itoa(int(host.Port))
+		}
+		writer.Write([]string{
+			host.Name(),
+			host.HostName,
+			host.Username,
+			port,
+			host.ProxyJump,
+			strings.Join(host.IdentityFiles, ","),
+			strings.Join(host.TagList, ","),
+			host.LabelsString(),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ExportHosts writes the filtered hosts in format ansible-ini, ansible-yaml, json or csv
+func ExportHosts(w io.Writer, format string, name string, user string, tags string, labels string) error {
+	hosts, err := FilteredHosts(name, user, tags, labels)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatAnsibleINI:
+		return writeAnsibleINI(w, hosts)
+	case FormatAnsibleYAML:
+		return writeAnsibleYAML(w, hosts)
+	case FormatJSON:
+		return writeJSON(w, hosts)
+	case FormatCSV:
+		return writeCSV(w, hosts)
+	default:
+		return fmt.Errorf("invalid export format: %s", format)
+	}
+}
+
+// importFormat guesses the inventory format by file extension
+func importFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		return FormatAnsibleYAML
+	case ".json":
+		return FormatJSON
+	default:
+		return FormatAnsibleINI
+	}
+}
+
+func LoadAnsibleInventory(path string, format string) (*Inventory, error) {
+	if format == "" {
+		format = importFormat(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var inventory *Inventory
+	switch format {
+	case FormatAnsibleINI:
+		inventory, err = parseAnsibleINI(strings.NewReader(string(data)))
+	case FormatAnsibleYAML:
+		inventory, err = parseAnsibleYAML(data)
+	case FormatJSON:
+		inventory, err = parsePluginOutput(data)
+	default:
+		return nil, fmt.Errorf("invalid import format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid inventory %s: %v", path, err)
+	}
+	return inventory, nil
+}
+
+// sshConfigBlock formats the host as ssh config Host block, tags and labels are in the end of line comment
+func sshConfigBlock(name string, hostConfig *InventoryHostConfig) string {
+	var block strings.Builder
+	block.WriteString("Host " + name)
+	comments := make([]string, 0, 2)
+	if len(hostConfig.Tags) > 0 {
+		comments = append(comments, "tags:"+strings.Join(hostConfig.Tags, ","))
+	}
+	if len(hostConfig.Labels) > 0 {
+		comments = append(comments, "labels: "+(&Host{Labels: hostConfig.Labels}).LabelsString())
+	}
+	if len(comments) > 0 {
+		block.WriteString(" # " + strings.Join(comments, " "))
+	}
+	block.WriteString("\n")
+
+	fmt.Fprintf(&block, "    HostName %s\n", hostConfig.HostName)
+	if hostConfig.User != "" {
+		fmt.Fprintf(&block, "    User %s\n", hostConfig.User)
+	}
+	if hostConfig.Port != 0 {
+		fmt.Fprintf(&block, "    Port %d\n", hostConfig.Port)
+	}
+	if hostConfig.ProxyJump != "" {
+		fmt.Fprintf(&block, "    ProxyJump %s\n", hostConfig.ProxyJump)
+	}
+	for _, identityFile := range hostConfig.IdentityFiles {
+		fmt.Fprintf(&block, "    IdentityFile %s\n", identityFile)
+	}
+	return block.String()
+}
+
+// ImportHosts converts the ansible inventory to ssh config Host blocks. They are written to w,
+// or appended to the first ssh config file if appendConfig, hosts already in it are skipped.
+func ImportHosts(w io.Writer, path string, format string, appendConfig bool) error {
+	inventory, err := LoadAnsibleInventory(path, format)
+	if err != nil {
+		return err
+	}
+
+	existing := make([]string, 0)
+	if appendConfig {
+		hosts, err := GetHostsFromSSHConfig()
+		if err != nil {
+			return err
+		}
+		for _, host := range hosts {
+			existing = append(existing, host.Patterns...)
+		}
+	}
+
+	blocks := make([]string, 0)
+	for _, name := range inventory.hostNames() {
+		if slices.Contains(existing, name) {
+			logger.Warnf("host %s is already in ssh config, skipped", name)
+			continue
+		}
+		blocks = append(blocks, sshConfigBlock(name, inventory.resolve(name)))
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	if !appendConfig {
+		_, err = io.WriteString(w, strings.Join(blocks, "\n"))
+		return err
+	}
+
+	// written atomically like "ds host add", the original file is kept as "<path>.bak"
+	file, err := loadSSHConfigFile(SSHConfigFiles()[0])
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if err := file.appendBlock(block); err != nil {
+			return err
+		}
+	}
+	return file.save()
+}
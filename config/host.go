@@ -2,28 +2,72 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/PWZER/dssh/logger"
-	"github.com/kevinburke/ssh_config"
 )
 
 type Host struct {
-	Patterns      []string
-	HostName      string
-	Username      string
-	Port          uint16
-	ProxyJump     string
-	TagList       []string
-	JumpList      []*Host
-	IdentityFiles []string
+	Patterns       []string
+	HostName       string
+	Username       string
+	Port           uint16
+	ProxyJump      string
+	TagList        []string
+	Labels         map[string]string
+	JumpList       []*Host
+	IdentityFiles  []string
+	ConnectTimeout time.Duration
+	Vars           map[string]string
+
+	// connection options from ssh config
+	ServerAliveInterval   time.Duration
+	ServerAliveCountMax   int
+	ForwardAgent          string // yes, no or empty
+	IdentitiesOnly        bool
+	CertificateFiles      []string
+	LocalForwards         []string // such as "8080 localhost:80"
+	RemoteForwards        []string
+	DynamicForwards       []string
+	SetEnv                []string // such as "NAME=value"
+	SendEnv               []string // local environment variable patterns
+	Ciphers               string
+	KexAlgorithms         string
+	MACs                  string
+	HostKeyAlgorithms     string
+	StrictHostKeyChecking string
+	UserKnownHostsFiles   []string
+	BatchMode             bool // prompts fail instead of reading the terminal
+	ReusePassword         bool // try the password entered for hosts of the same user and tag or jump
+
+	jumpChain []string // names of the hosts jumping to this host
+	jumpErr   error
 }
 
 func NewHost(username, hostname string, port uint16, proxyJump string, identityFiles []string) (host *Host, err error) {
+	host, err = parseHost(username, hostname, port, proxyJump, identityFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	host.fillWithInventory()
+	host.FillAttrsWithSSHConfig()
+	if host.jumpErr != nil {
+		return nil, host.jumpErr
+	}
+
+	logger.Debugf("host: %+#v", host)
+	return host, nil
+}
+
+// parseHost parses the host from "user@hostname:port" without ssh config
+func parseHost(username, hostname string, port uint16, proxyJump string, identityFiles []string) (host *Host, err error) {
 	host = &Host{
 		Username:      username,
 		HostName:      hostname,
@@ -80,12 +124,26 @@ func NewHost(username, hostname string, port uint16, proxyJump string, identityF
 		host.IdentityFiles = append(host.IdentityFiles, identityFile)
 	}
 
-	host.FillAttrsWithSSHConfig()
-
-	logger.Debugf("host: %+#v", host)
+	// keep the name given by user, it's also the ssh config pattern
+	host.Patterns = []string{host.HostName}
 	return host, nil
 }
 
+// JumpError returns the error of ProxyJump, such as a jump cycle or an invalid jump
+func (host *Host) JumpError() error {
+	return host.jumpErr
+}
+
+func (host *Host) Name() string {
+	for _, pattern := range host.Patterns {
+		if strings.ContainsAny(pattern, "*!?") {
+			continue
+		}
+		return pattern
+	}
+	return host.HostName
+}
+
 func (host *Host) EndPoint() string {
 	if host.Port == 0 {
 		return host.HostName
@@ -108,16 +166,27 @@ func (host *Host) JumpString() string {
 	return strings.Join(hosts, ",")
 }
 
-func (host *Host) MatchTags(tags []string) bool {
-	if len(tags) == 0 {
+func (host *Host) MatchTags(selector *TagSelector) bool {
+	if selector == nil {
 		return false
 	}
-	for _, tag := range tags {
-		if slices.Contains(host.TagList, tag) {
-			return true
-		}
+	return selector.Match(host.TagList)
+}
+
+func (host *Host) MatchLabels(selector *LabelSelector) bool {
+	if selector == nil {
+		return false
 	}
-	return false
+	return selector.Match(host.Labels)
+}
+
+// LabelsString returns labels sorted by key, such as "env=prod,role=db"
+func (host *Host) LabelsString() string {
+	pairs := make([]string, 0, len(host.Labels))
+	for _, key := range slices.Sorted(maps.Keys(host.Labels)) {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, host.Labels[key]))
+	}
+	return strings.Join(pairs, ",")
 }
 
 func (host *Host) fillUsername() {
@@ -130,7 +199,7 @@ func (host *Host) fillUsername() {
 		if strings.ContainsAny(pattern, "*!?") {
 			continue
 		}
-		host.Username = ssh_config.Get(pattern, "User")
+		host.Username = sshConfigGet(pattern, host.Username, "User")
 		if host.Username != "" {
 			break
 		}
@@ -138,7 +207,7 @@ func (host *Host) fillUsername() {
 
 	// fill username with host name
 	if host.Username == "" {
-		host.Username = ssh_config.Get(host.HostName, "User")
+		host.Username = sshConfigGet(host.HostName, host.Username, "User")
 	}
 
 	// fill username with environment variable
@@ -162,7 +231,7 @@ func (host *Host) fillPort() {
 		if strings.ContainsAny(pattern, "*!?") {
 			continue
 		}
-		portInt, err := strconv.Atoi(ssh_config.Get(pattern, "Port"))
+		portInt, err := strconv.Atoi(sshConfigGet(pattern, host.Username, "Port"))
 		if err != nil {
 			continue
 		}
@@ -175,7 +244,7 @@ func (host *Host) fillPort() {
 
 	// fill port with host name
 	if host.Port == 0 {
-		portInt, err := strconv.Atoi(ssh_config.Get(host.HostName, "Port"))
+		portInt, err := strconv.Atoi(sshConfigGet(host.HostName, host.Username, "Port"))
 		if err != nil {
 			return
 		}
@@ -188,6 +257,33 @@ func (host *Host) fillPort() {
 	}
 }
 
+func (host *Host) fillConnectTimeout() {
+	if host.ConnectTimeout != 0 {
+		return
+	}
+
+	// fill connect timeout with patterns, then host name
+	for _, alias := range slices.Concat(host.Patterns, []string{host.HostName}) {
+		if strings.ContainsAny(alias, "*!?") {
+			continue
+		}
+		value := sshConfigGet(alias, host.Username, "ConnectTimeout")
+		if value == "" {
+			continue
+		}
+		timeout, err := parseSeconds(value)
+		if err != nil {
+			logger.Warnf("host %s invalid ConnectTimeout: %v", host.Name(), err)
+			continue
+		}
+		if timeout <= 0 {
+			continue
+		}
+		host.ConnectTimeout = timeout
+		return
+	}
+}
+
 func (host *Host) fillProxyJump() {
 	if host.ProxyJump == "" {
 		// fill proxy jump with patterns
@@ -195,74 +291,88 @@ func (host *Host) fillProxyJump() {
 			if strings.ContainsAny(pattern, "*!?") {
 				continue
 			}
-			host.ProxyJump = ssh_config.Get(pattern, "ProxyJump")
+			host.ProxyJump = sshConfigGet(pattern, host.Username, "ProxyJump")
 		}
 
 		// fill proxy jump with host name
 		if host.ProxyJump == "" {
-			host.ProxyJump = ssh_config.Get(host.HostName, "ProxyJump")
+			host.ProxyJump = sshConfigGet(host.HostName, host.Username, "ProxyJump")
 		}
 	}
 
-	// jump list
+	if strings.EqualFold(host.ProxyJump, "none") {
+		host.ProxyJump = ""
+	}
+
+	// jump list, the jumps of jump host are before it
 	if host.ProxyJump != "" {
+		chain := append(slices.Clone(host.jumpChain), host.Name())
 		for _, jump := range strings.Split(host.ProxyJump, ",") {
+			jump = strings.TrimPrefix(strings.TrimSpace(jump), "ssh://")
 			if jump == "" {
 				continue
 			}
-			jumpHost, err := NewHost("", jump, 0, "", host.IdentityFiles)
+			jumpHost, err := parseHost("", jump, 0, "", nil)
 			if err != nil {
-				continue
+				host.jumpErr = fmt.Errorf("invalid proxy jump %q of %s: %v", jump, host.Name(), err)
+				return
+			}
+			if slices.Contains(chain, jumpHost.Name()) {
+				host.jumpErr = fmt.Errorf("proxy jump cycle: %s", strings.Join(append(chain, jumpHost.Name()), " -> "))
+				return
+			}
+			jumpHost.jumpChain = chain
+			jumpHost.fillWithInventory()
+			jumpHost.FillAttrsWithSSHConfig()
+			if jumpHost.jumpErr != nil {
+				host.jumpErr = jumpHost.jumpErr
+				return
 			}
+			if len(jumpHost.IdentityFiles) == 0 {
+				jumpHost.IdentityFiles = host.IdentityFiles
+			}
+			host.JumpList = append(host.JumpList, jumpHost.JumpList...)
 			host.JumpList = append(host.JumpList, jumpHost)
 		}
 	}
 }
 
+// default identity files of ssh
+var defaultIdentityFiles = []string{"id_rsa", "id_ecdsa", "id_ecdsa_sk", "id_ed25519", "id_ed25519_sk"}
+
 func (host *Host) fillIdentityFiles() {
 	if len(host.IdentityFiles) > 0 {
 		return
 	}
 
-	// fill identity files with patterns
-	for _, pattern := range host.Patterns {
-		if strings.ContainsAny(pattern, "*!?") {
-			continue
-		}
-		identityFiles := ssh_config.GetAll(pattern, "IdentityFile")
-		for _, identityFile := range identityFiles {
-			if _, err := os.Stat(identityFile); err == nil {
-				host.IdentityFiles = append(host.IdentityFiles, identityFile)
-			}
+	// fill identity files with patterns, then host name
+	for _, identityFile := range host.sshConfigValues("IdentityFile") {
+		identityFile = host.expandPath(identityFile)
+		if _, err := os.Stat(identityFile); err == nil {
+			host.IdentityFiles = append(host.IdentityFiles, identityFile)
 		}
 	}
 
-	// fill identity files with host name
+	// default identity files
 	if len(host.IdentityFiles) == 0 {
-		identityFiles := ssh_config.GetAll(host.HostName, "IdentityFile")
-		for _, identityFile := range identityFiles {
-			if _, err := os.Stat(identityFile); err == nil {
-				host.IdentityFiles = append(host.IdentityFiles, identityFile)
+		for _, name := range defaultIdentityFiles {
+			defaultIdentityFile := filepath.Join(os.Getenv("HOME"), ".ssh", name)
+			if _, err := os.Stat(defaultIdentityFile); err == nil {
+				host.IdentityFiles = append(host.IdentityFiles, defaultIdentityFile)
 			}
 		}
 	}
-
-	// default identity file
-	if len(host.IdentityFiles) == 0 {
-		defaultIdentityFile := filepath.Join(os.Getenv("HOME"), ".ssh", "id_rsa")
-		if _, err := os.Stat(defaultIdentityFile); err == nil {
-			host.IdentityFiles = []string{defaultIdentityFile}
-		}
-	}
 }
 
 func (host *Host) FillAttrsWithSSHConfig() {
 	host.fillUsername()
 	host.fillPort()
+	host.fillConnectTimeout()
 	host.fillIdentityFiles()
 	host.fillProxyJump() // must after identity files
+	host.fillOptions()
 
-	rawHostname := ssh_config.Get(host.HostName, "HostName")
+	rawHostname := sshConfigGet(host.HostName, host.Username, "HostName")
 	if rawHostname != "" {
 		host.HostName = rawHostname
 	}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+
+	"github.com/PWZER/dssh/logger"
+)
+
+const (
+	defaultServerAliveCountMax = 3
+	defaultUserKnownHostsFiles = "~/.ssh/known_hosts ~/.ssh/known_hosts2"
+)
+
+// DefaultKnownHostsFiles returns the known_hosts files used when UserKnownHostsFile is not set
+func DefaultKnownHostsFiles() (files []string) {
+	for _, file := range strings.Fields(defaultUserKnownHostsFiles) {
+		if expanded, err := homedir.Expand(file); err == nil {
+			file = expanded
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// aliases returns the names to resolve ssh config, the patterns without globs then host name
+func (host *Host) aliases() []string {
+	aliases := make([]string, 0, len(host.Patterns)+1)
+	for _, pattern := range host.Patterns {
+		if !strings.ContainsAny(pattern, "*!?") {
+			aliases = append(aliases, pattern)
+		}
+	}
+	return append(aliases, host.HostName)
+}
+
+// sshConfigValue returns the first configured value of key, without ssh default values
+func (host *Host) sshConfigValue(key string) string {
+	for _, alias := range host.aliases() {
+		if value := resolveSSHOptions(alias, host.Username).get(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// sshConfigValues returns all configured values of key, without ssh default values
+func (host *Host) sshConfigValues(key string) []string {
+	for _, alias := range host.aliases() {
+		if values := resolveSSHOptions(alias, host.Username)[strings.ToLower(key)]; len(values) > 0 {
+			return values
+		}
+	}
+	return nil
+}
+
+// expandPath expands "~" and the tokens %d, %u, %h, %r, %n in file path like ssh
+func (host *Host) expandPath(path string) string {
+	homeDir, _ := homedir.Dir()
+	localHost, _ := os.Hostname()
+	path = strings.NewReplacer(
+		"%%", "%",
+		"%d", homeDir,
+		"%u", localUsername(),
+		"%h", host.HostName,
+		"%r", host.Username,
+		"%n", host.Name(),
+		"%l", localHost,
+	).Replace(path)
+	if expanded, err := homedir.Expand(path); err == nil {
+		return expanded
+	}
+	return path
+}
+
+func parseYesNo(value string) bool {
+	switch strings.ToLower(value) {
+	case "yes", "true":
+		return true
+	}
+	return false
+}
+
+// parseSeconds parses the ssh time format, such as "30", "1m30s" or "1h", the units are
+// s, m, h, d and w in any case, a number without unit is seconds
+func parseSeconds(value string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		's': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour,
+	}
+	var total time.Duration
+	rest := strings.TrimSpace(value)
+	if rest == "" {
+		return 0, fmt.Errorf("invalid time: %q", value)
+	}
+	for rest != "" {
+		end := 0
+		for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+			end++
+		}
+		number, err := strconv.Atoi(rest[:end])
+		if err != nil {
+			return 0, fmt.Errorf("invalid time: %q", value)
+		}
+		unit := time.Second
+		if end < len(rest) {
+			var ok bool
+			if unit, ok = units[rest[end]|0x20]; !ok {
+				return 0, fmt.Errorf("invalid time: %q", value)
+			}
+			end++
+		}
+		total += time.Duration(number) * unit
+		rest = rest[end:]
+	}
+	return total, nil
+}
+
+// fillOptions fills the connection options from ssh config
+func (host *Host) fillOptions() {
+	if value := host.sshConfigValue("ServerAliveInterval"); value != "" {
+		interval, err := parseSeconds(value)
+		if err != nil {
+			logger.Warnf("host %s invalid ServerAliveInterval: %v", host.Name(), err)
+		}
+		host.ServerAliveInterval = interval
+	}
+	host.ServerAliveCountMax = defaultServerAliveCountMax
+	if countMax, err := strconv.Atoi(host.sshConfigValue("ServerAliveCountMax")); err == nil && countMax > 0 {
+		host.ServerAliveCountMax = countMax
+	}
+
+	// ForwardAgent may be a socket path, it's same as yes
+	switch forwardAgent := strings.ToLower(host.sshConfigValue("ForwardAgent")); forwardAgent {
+	case "", "no", "false":
+		host.ForwardAgent = forwardAgent
+		if forwardAgent == "false" {
+			host.ForwardAgent = "no"
+		}
+	default:
+		host.ForwardAgent = "yes"
+	}
+
+	host.BatchMode = parseYesNo(host.sshConfigValue("BatchMode"))
+	host.IdentitiesOnly = parseYesNo(host.sshConfigValue("IdentitiesOnly"))
+	for _, certificateFile := range host.sshConfigValues("CertificateFile") {
+		host.CertificateFiles = append(host.CertificateFiles, host.expandPath(certificateFile))
+	}
+
+	host.LocalForwards = host.sshConfigValues("LocalForward")
+	host.RemoteForwards = host.sshConfigValues("RemoteForward")
+	host.DynamicForwards = host.sshConfigValues("DynamicForward")
+	for _, value := range host.sshConfigValues("SetEnv") {
+		host.SetEnv = append(host.SetEnv, splitFields(value)...)
+	}
+	for _, value := range host.sshConfigValues("SendEnv") {
+		host.SendEnv = append(host.SendEnv, splitFields(value)...)
+	}
+
+	host.Ciphers = host.sshConfigValue("Ciphers")
+	host.KexAlgorithms = host.sshConfigValue("KexAlgorithms")
+	host.MACs = host.sshConfigValue("MACs")
+	host.HostKeyAlgorithms = host.sshConfigValue("HostKeyAlgorithms")
+
+	host.StrictHostKeyChecking = strings.ToLower(host.sshConfigValue("StrictHostKeyChecking"))
+	if host.StrictHostKeyChecking == "off" {
+		host.StrictHostKeyChecking = "no"
+	}
+	knownHostsFiles := host.sshConfigValue("UserKnownHostsFile")
+	if knownHostsFiles == "" {
+		knownHostsFiles = defaultUserKnownHostsFiles
+	}
+	for _, knownHostsFile := range splitFields(knownHostsFiles) {
+		host.UserKnownHostsFiles = append(host.UserKnownHostsFiles, host.expandPath(knownHostsFile))
+	}
+}
@@ -0,0 +1,370 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	homedir "github.com/mitchellh/go-homedir"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/PWZER/dssh/logger"
+)
+
+// InventoryHostConfig is the connection settings and metadata of inventory host or group
+type InventoryHostConfig struct {
+	HostName      string            `yaml:"hostname,omitempty" json:"hostname,omitempty"`
+	User          string            `yaml:"user,omitempty" json:"user,omitempty"`
+	Port          uint16            `yaml:"port,omitempty" json:"port,omitempty"`
+	ProxyJump     string            `yaml:"jump,omitempty" json:"jump,omitempty"`
+	IdentityFiles []string          `yaml:"identityFiles,omitempty" json:"identityFiles,omitempty"`
+	Tags          []string          `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Labels        map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Vars          map[string]string `yaml:"vars,omitempty" json:"vars,omitempty"`
+}
+
+type InventoryGroup struct {
+	InventoryHostConfig `yaml:",inline"`
+	Hosts               []string `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+	Children            []string `yaml:"children,omitempty" json:"children,omitempty"`
+}
+
+// Inventory is the standalone dssh hosts file, such as:
+//
+//	defaults:
+//	  user: deploy
+//	hosts:
+//	  web-01:
+//	    hostname: 10.0.0.1
+//	groups:
+//	  web:
+//	    hosts: [web-01]
+//	    jump: bastion
+//	  prod:
+//	    children: [web]
+//	    vars: {env: prod}
+//
+// Host settings override its groups', child groups override parent groups', groups override defaults.
+// Group names are added to the host tags.
+type Inventory struct {
+	Defaults InventoryHostConfig             `yaml:"defaults,omitempty" json:"defaults,omitempty"`
+	Hosts    map[string]*InventoryHostConfig `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+	Groups   map[string]*InventoryGroup      `yaml:"groups,omitempty" json:"groups,omitempty"`
+}
+
+func LoadInventory(path string) (*Inventory, error) {
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory, err := parseInventory(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inventory %s: %v", path, err)
+	}
+	return inventory, nil
+}
+
+// parseInventory parses inventory in YAML, or JSON which is also YAML
+func parseInventory(data []byte) (*Inventory, error) {
+	inventory := &Inventory{}
+	if err := yaml.UnmarshalStrict(data, inventory); err != nil {
+		return nil, err
+	}
+	if err := inventory.validate(); err != nil {
+		return nil, err
+	}
+	return inventory, nil
+}
+
+func (inv *Inventory) validate() error {
+	for name, group := range inv.Groups {
+		for _, child := range group.Children {
+			if _, ok := inv.Groups[child]; !ok {
+				return fmt.Errorf("group %s child group %s not found", name, child)
+			}
+		}
+		if _, err := inv.groupChain(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupChain returns the group and all its ancestors, the nearest first
+func (inv *Inventory) groupChain(name string, visiting []string) ([]string, error) {
+	if slices.Contains(visiting, name) {
+		return nil, fmt.Errorf("group cycle: %v -> %s", visiting, name)
+	}
+	visiting = append(visiting, name)
+
+	chain := []string{name}
+	for _, parent := range slices.Sorted(maps.Keys(inv.Groups)) {
+		if !slices.Contains(inv.Groups[parent].Children, name) {
+			continue
+		}
+		parents, err := inv.groupChain(parent, visiting)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range parents {
+			if !slices.Contains(chain, group) {
+				chain = append(chain, group)
+			}
+		}
+	}
+	return chain, nil
+}
+
+// hostGroups returns all groups of the host, the nearest first
+func (inv *Inventory) hostGroups(name string) (groups []string) {
+	for _, group := range slices.Sorted(maps.Keys(inv.Groups)) {
+		if !slices.Contains(inv.Groups[group].Hosts, name) {
+			continue
+		}
+		chain, _ := inv.groupChain(group, nil)
+		for _, g := range chain {
+			if !slices.Contains(groups, g) {
+				groups = append(groups, g)
+			}
+		}
+	}
+	return groups
+}
+
+// hostNames returns hosts defined in hosts and groups, sorted by name
+func (inv *Inventory) hostNames() []string {
+	names := slices.Collect(maps.Keys(inv.Hosts))
+	for _, group := range inv.Groups {
+		for _, name := range group.Hosts {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// merge fills empty connection settings and merges metadata from lower priority config
+func (c *InventoryHostConfig) merge(lower *InventoryHostConfig) {
+	if c.HostName == "" {
+		c.HostName = lower.HostName
+	}
+	if c.User == "" {
+		c.User = lower.User
+	}
+	if c.Port == 0 {
+		c.Port = lower.Port
+	}
+	if c.ProxyJump == "" {
+		c.ProxyJump = lower.ProxyJump
+	}
+	if len(c.IdentityFiles) == 0 {
+		c.IdentityFiles = lower.IdentityFiles
+	}
+	for _, tag := range lower.Tags {
+		if !slices.Contains(c.Tags, tag) {
+			c.Tags = append(c.Tags, tag)
+		}
+	}
+	for key, value := range lower.Labels {
+		if _, ok := c.Labels[key]; !ok {
+			c.Labels[key] = value
+		}
+	}
+	for key, value := range lower.Vars {
+		if _, ok := c.Vars[key]; !ok {
+			c.Vars[key] = value
+		}
+	}
+}
+
+// resolve merges the host config with its groups and defaults
+func (inv *Inventory) resolve(name string) *InventoryHostConfig {
+	resolved := &InventoryHostConfig{Labels: map[string]string{}, Vars: map[string]string{}}
+	if hostConfig, ok := inv.Hosts[name]; ok && hostConfig != nil {
+		resolved.merge(hostConfig)
+	}
+	for _, group := range inv.hostGroups(name) {
+		resolved.merge(&inv.Groups[group].InventoryHostConfig)
+		if !slices.Contains(resolved.Tags, group) {
+			resolved.Tags = append(resolved.Tags, group)
+		}
+	}
+	resolved.merge(&inv.Defaults)
+
+	if resolved.HostName == "" {
+		resolved.HostName = name
+	}
+	return resolved
+}
+
+// has reports whether the host is defined in hosts or groups
+func (inv *Inventory) has(name string) bool {
+	return slices.Contains(inv.hostNames(), name)
+}
+
+// applyInventory fills empty connection settings and merges metadata from inventory
+func (host *Host) applyInventory(resolved *InventoryHostConfig) {
+	host.HostName = resolved.HostName
+	if host.Username == "" {
+		host.Username = resolved.User
+	}
+	if host.Port == 0 {
+		host.Port = resolved.Port
+	}
+	if host.ProxyJump == "" {
+		host.ProxyJump = resolved.ProxyJump
+	}
+	if len(host.IdentityFiles) == 0 {
+		for _, identityFile := range resolved.IdentityFiles {
+			if path, err := homedir.Expand(identityFile); err == nil {
+				host.IdentityFiles = append(host.IdentityFiles, path)
+			}
+		}
+	}
+	host.mergeHostMeta(&Host{TagList: resolved.Tags, Labels: resolved.Labels, Vars: resolved.Vars})
+}
+
+// fillWithInventory fills the host given by name with the first inventory which defines it
+func (host *Host) fillWithInventory() {
+	inventories, err := loadInventories()
+	if err != nil {
+		logger.Warnf("load inventory failed: %v", err)
+		return
+	}
+	for _, inventory := range inventories {
+		if !inventory.has(host.HostName) {
+			continue
+		}
+		resolved := inventory.resolve(host.HostName)
+		if sshConfigGet(host.HostName, host.Username, "HostName") != "" {
+			// settings in ssh config take precedence
+			host.mergeHostMeta(&Host{TagList: resolved.Tags, Labels: resolved.Labels, Vars: resolved.Vars})
+			return
+		}
+		host.applyInventory(resolved)
+		return
+	}
+}
+
+func (inv *Inventory) Host(name string) *Host {
+	host := &Host{Patterns: []string{name}}
+	host.applyInventory(inv.resolve(name))
+	host.FillAttrsWithSSHConfig()
+	return host
+}
+
+func (inv *Inventory) GetHosts() (hosts []*Host) {
+	for _, name := range inv.hostNames() {
+		hosts = append(hosts, inv.Host(name))
+	}
+	return hosts
+}
+
+var (
+	inventories    []*Inventory
+	inventoriesErr error
+)
+
+// loadInventories loads all inventory files and plugins in config once,
+// the failure is also kept, so that a failing plugin is not run again for each host
+func loadInventories() ([]*Inventory, error) {
+	if inventories != nil || inventoriesErr != nil {
+		return inventories, inventoriesErr
+	}
+	loaded := make([]*Inventory, 0, len(Config.Inventory))
+	for _, path := range Config.Inventory {
+		inventory, err := LoadInventory(path)
+		if err != nil {
+			inventoriesErr = err
+			return nil, err
+		}
+		loaded = append(loaded, inventory)
+	}
+	for _, plugin := range Config.InventoryPlugins {
+		inventory, err := LoadInventoryPlugin(plugin)
+		if err != nil {
+			inventoriesErr = err
+			return nil, err
+		}
+		loaded = append(loaded, inventory)
+	}
+	inventories = loaded
+	return inventories, nil
+}
+
+// GetHostsFromInventories returns hosts from all inventory files and plugins in config
+func GetHostsFromInventories() (hosts []*Host, err error) {
+	inventories, err := loadInventories()
+	if err != nil {
+		return nil, err
+	}
+	for _, inventory := range inventories {
+		for _, host := range inventory.GetHosts() {
+			if slices.ContainsFunc(hosts, func(h *Host) bool { return h.Name() == host.Name() }) {
+				continue
+			}
+			hosts = append(hosts, host)
+		}
+	}
+	logger.Debugf("inventory hosts: %+#v", hosts)
+	return hosts, nil
+}
+
+// mergeHostMeta adds tags, labels and vars of other host which has the same name
+func (host *Host) mergeHostMeta(other *Host) {
+	for _, tag := range other.TagList {
+		if !slices.Contains(host.TagList, tag) {
+			host.TagList = append(host.TagList, tag)
+		}
+	}
+	for key, value := range other.Labels {
+		if host.Labels == nil {
+			host.Labels = make(map[string]string)
+		}
+		if _, ok := host.Labels[key]; !ok {
+			host.Labels[key] = value
+		}
+	}
+	for key, value := range other.Vars {
+		if host.Vars == nil {
+			host.Vars = make(map[string]string)
+		}
+		if _, ok := host.Vars[key]; !ok {
+			host.Vars[key] = value
+		}
+	}
+}
+
+// GetHosts returns hosts from ssh config and inventories. When a host is in both,
+// the settings in ssh config are used and the tags, labels and vars are merged.
+func GetHosts() (hosts []*Host, err error) {
+	hosts, err = GetHostsFromSSHConfig()
+	if err != nil {
+		return hosts, err
+	}
+
+	inventoryHosts, err := GetHostsFromInventories()
+	if err != nil {
+		return hosts, err
+	}
+
+	for _, inventoryHost := range inventoryHosts {
+		index := slices.IndexFunc(hosts, func(host *Host) bool {
+			return slices.Contains(host.Patterns, inventoryHost.Name())
+		})
+		if index >= 0 {
+			hosts[index].mergeHostMeta(inventoryHost)
+			continue
+		}
+		hosts = append(hosts, inventoryHost)
+	}
+	return hosts, nil
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+
+	"github.com/PWZER/dssh/logger"
+)
+
+const (
+	defaultInventoryCacheTTL = 5 * time.Minute
+	inventoryPluginTimeout   = 30 * time.Second
+)
+
+// InventoryRefresh ignores the cached output of inventory plugins
+var InventoryRefresh bool
+
+func inventoryCacheTTL() time.Duration {
+	if Config.InventoryCacheTTL != 0 {
+		return Config.InventoryCacheTTL
+	}
+	return defaultInventoryCacheTTL
+}
+
+func inventoryCachePath(plugin string) string {
+	sum := sha256.Sum256([]byte(plugin))
+	return filepath.Join(StateDir(), "inventory", hex.EncodeToString(sum[:8])+".json")
+}
+
+// runInventoryPlugin runs the plugin with "--list" like ansible dynamic inventory
+func runInventoryPlugin(plugin string) ([]byte, error) {
+	args := strings.Fields(plugin)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty inventory plugin")
+	}
+	executable, err := homedir.Expand(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), inventoryPluginTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, executable, append(args[1:], "--list")...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("run inventory plugin %s failed: %v %s", plugin, err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// inventoryPluginOutput returns the plugin output, it's cached in state dir until the ttl expires.
+// The stale cache is used if the plugin failed.
+func inventoryPluginOutput(plugin string) ([]byte, error) {
+	cachePath := inventoryCachePath(plugin)
+	stat, statErr := os.Stat(cachePath)
+	if statErr == nil && !InventoryRefresh && time.Since(stat.ModTime()) < inventoryCacheTTL() {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			return data, nil
+		}
+	}
+
+	output, err := runInventoryPlugin(plugin)
+	if err != nil {
+		if statErr == nil {
+			if data, readErr := os.ReadFile(cachePath); readErr == nil {
+				logger.Warnf("%v, use the cache of %s", err, stat.ModTime().Format(time.RFC3339))
+				return data, nil
+			}
+		}
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+		logger.Warnf("save inventory cache failed: %v", err)
+	} else if err := os.WriteFile(cachePath, output, 0600); err != nil {
+		logger.Warnf("save inventory cache failed: %v", err)
+	}
+	return output, nil
+}
+
+func LoadInventoryPlugin(plugin string) (*Inventory, error) {
+	output, err := inventoryPluginOutput(plugin)
+	if err != nil {
+		return nil, err
+	}
+	inventory, err := parsePluginOutput(output)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inventory plugin %s output: %v", plugin, err)
+	}
+	return inventory, nil
+}
+
+// parsePluginOutput parses the dssh inventory in JSON, or the ansible "--list" JSON
+func parsePluginOutput(output []byte) (*Inventory, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(output, &raw); err != nil {
+		return nil, err
+	}
+	if isAnsibleInventory(raw) {
+		return parseAnsibleJSON(raw)
+	}
+	return parseInventory(output)
+}
+
+func isAnsibleInventory(raw map[string]json.RawMessage) bool {
+	if _, ok := raw["_meta"]; ok {
+		return true
+	}
+	for key, value := range raw {
+		switch key {
+		case "defaults", "groups":
+		case "hosts":
+			// the hosts of dssh inventory is an object, it's a group in ansible
+			if !bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+				return true
+			}
+			var group struct {
+				Hosts []string `json:"hosts"`
+			}
+			if json.Unmarshal(value, &group) == nil && group.Hosts != nil {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
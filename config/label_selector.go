@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	labelKeyRegex   = regexp.MustCompile(`^[0-9a-zA-Z_\-./]+$`)
+	labelValueRegex = regexp.MustCompile(`^[0-9a-zA-Z_\-.]*$`)
+	labelSetRegex   = regexp.MustCompile(`^([^\s]+)\s+(in|notin)\s*\((.*)\)$`)
+	labelOpRegex    = regexp.MustCompile(`^([^\s=!]+)\s*(==|=|!=)\s*([^\s]*)$`)
+)
+
+const (
+	labelOpExists    = "exists"
+	labelOpNotExists = "!"
+	labelOpEquals    = "="
+	labelOpNotEquals = "!="
+	labelOpIn        = "in"
+	labelOpNotIn     = "notin"
+)
+
+type labelRequirement struct {
+	key    string
+	op     string
+	values []string
+}
+
+func (req *labelRequirement) match(labels map[string]string) bool {
+	value, exists := labels[req.key]
+	switch req.op {
+	case labelOpExists:
+		return exists
+	case labelOpNotExists:
+		return !exists
+	case labelOpEquals, labelOpIn:
+		return exists && slices.Contains(req.values, value)
+	case labelOpNotEquals, labelOpNotIn:
+		return !exists || !slices.Contains(req.values, value)
+	}
+	return false
+}
+
+// LabelSelector selects hosts by labels like kubernetes, requirements are joined by and:
+//
+//	env=prod                 env is prod, "==" is the same
+//	env!=prod                env is not prod or env not set
+//	role in (db,cache)       role is db or cache
+//	role notin (db,cache)    role is neither db nor cache
+//	region                   region is set
+//	!region                  region is not set
+type LabelSelector struct {
+	requirements []*labelRequirement
+}
+
+// split by commas which are not in parentheses
+func splitLabelSelector(expr string) (parts []string, err error) {
+	depth, start := 0, 0
+	for i, c := range expr {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced parentheses")
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses")
+	}
+	return append(parts, expr[start:]), nil
+}
+
+func validateLabel(key string, values ...string) error {
+	if !labelKeyRegex.MatchString(key) {
+		return fmt.Errorf("invalid label key: %q", key)
+	}
+	for _, value := range values {
+		if !labelValueRegex.MatchString(value) {
+			return fmt.Errorf("invalid label value: %q", value)
+		}
+	}
+	return nil
+}
+
+func parseLabelRequirement(text string) (*labelRequirement, error) {
+	if text == "" {
+		return nil, fmt.Errorf("empty requirement")
+	}
+
+	req := &labelRequirement{}
+	if match := labelSetRegex.FindStringSubmatch(text); match != nil {
+		req.key, req.op = match[1], match[2]
+		for _, value := range strings.Split(match[3], ",") {
+			req.values = append(req.values, strings.TrimSpace(value))
+		}
+	} else if match := labelOpRegex.FindStringSubmatch(text); match != nil {
+		req.key, req.values = match[1], []string{match[3]}
+		req.op = labelOpEquals
+		if match[2] == "!=" {
+			req.op = labelOpNotEquals
+		}
+	} else if key, ok := strings.CutPrefix(text, "!"); ok {
+		req.key, req.op = strings.TrimSpace(key), labelOpNotExists
+	} else {
+		req.key, req.op = text, labelOpExists
+	}
+
+	if err := validateLabel(req.key, req.values...); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// ParseLabelSelector parses label selector expressions, multiple expressions are joined by ","
+func ParseLabelSelector(exprs ...string) (*LabelSelector, error) {
+	expr := strings.Join(exprs, ",")
+	parts, err := splitLabelSelector(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid labels selector %q: %v", expr, err)
+	}
+
+	selector := &LabelSelector{}
+	for _, part := range parts {
+		req, err := parseLabelRequirement(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid labels selector %q: %v", expr, err)
+		}
+		selector.requirements = append(selector.requirements, req)
+	}
+	return selector, nil
+}
+
+func (selector *LabelSelector) Match(labels map[string]string) bool {
+	for _, req := range selector.requirements {
+		if !req.match(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabels parses labels like "env=prod,role=db"
+func ParseLabels(text string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(text, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label: %q", pair)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if err := validateLabel(key, value); err != nil {
+			return nil, err
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var tagPatternRegex = regexp.MustCompile(`^[0-9a-zA-Z_\-.*?\[\]]+$`)
+
+type tagFactor struct {
+	pattern string
+	negated bool
+}
+
+func (factor *tagFactor) match(tags []string) bool {
+	matched := slices.ContainsFunc(tags, func(tag string) bool {
+		ok, _ := path.Match(factor.pattern, tag)
+		return ok
+	})
+	return matched != factor.negated
+}
+
+// TagSelector selects hosts by tags, the expression syntax:
+//
+//	web,db         web or db
+//	web&prod       web and prod
+//	region-*       glob pattern, supports * ? and [...]
+//	db,!staging    a term with only negations filters the result: db but not staging
+//	!canary        all hosts except canary
+type TagSelector struct {
+	includes [][]*tagFactor // terms with any positive factor, joined by or
+	filters  [][]*tagFactor // terms with only negated factors, joined by and
+}
+
+func parseTagFactor(text string) (*tagFactor, error) {
+	factor := &tagFactor{}
+	if strings.HasPrefix(text, "!") {
+		factor.negated = true
+		text = text[1:]
+	}
+	if text == "" {
+		return nil, fmt.Errorf("empty tag")
+	}
+	if !tagPatternRegex.MatchString(text) {
+		return nil, fmt.Errorf("invalid tag: %q", text)
+	}
+	if _, err := path.Match(text, ""); err != nil {
+		return nil, fmt.Errorf("invalid tag pattern: %q", text)
+	}
+	factor.pattern = text
+	return factor, nil
+}
+
+// ParseTagSelector parses tag selector expressions, multiple expressions are joined by ","
+func ParseTagSelector(exprs ...string) (*TagSelector, error) {
+	selector := &TagSelector{}
+	expr := strings.Join(exprs, ",")
+	if strings.TrimSpace(expr) == "" {
+		return nil, fmt.Errorf("empty tags selector")
+	}
+
+	for _, termText := range strings.Split(expr, ",") {
+		term := make([]*tagFactor, 0)
+		positive := false
+		for _, factorText := range strings.Split(termText, "&") {
+			factor, err := parseTagFactor(strings.TrimSpace(factorText))
+			if err != nil {
+				return nil, fmt.Errorf("invalid tags selector %q: %v", expr, err)
+			}
+			positive = positive || !factor.negated
+			term = append(term, factor)
+		}
+		if positive {
+			selector.includes = append(selector.includes, term)
+		} else {
+			selector.filters = append(selector.filters, term)
+		}
+	}
+	return selector, nil
+}
+
+func matchTerm(term []*tagFactor, tags []string) bool {
+	for _, factor := range term {
+		if !factor.match(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+func (selector *TagSelector) Match(tags []string) bool {
+	for _, term := range selector.filters {
+		if !matchTerm(term, tags) {
+			return false
+		}
+	}
+	if len(selector.includes) == 0 {
+		return true
+	}
+	for _, term := range selector.includes {
+		if matchTerm(term, tags) {
+			return true
+		}
+	}
+	return false
+}
@@ -5,11 +5,13 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/PWZER/dssh/logger"
 	"github.com/kevinburke/ssh_config"
+	homedir "github.com/mitchellh/go-homedir"
 )
 
 func hostFromSSHConfig(hostConfig *ssh_config.Host) (host *Host, err error) {
@@ -43,6 +45,13 @@ func hostFromSSHConfig(hostConfig *ssh_config.Host) (host *Host, err error) {
 				host.Port = uint16(port)
 			case "ProxyJump":
 				host.ProxyJump = kv.Value
+			case "ConnectTimeout":
+				timeout, err := parseSeconds(kv.Value)
+				if err != nil {
+					logger.Warnf("host %s invalid ConnectTimeout: %v", host.Name(), err)
+					continue
+				}
+				host.ConnectTimeout = timeout
 			case "IdentityFile":
 				host.IdentityFiles = append(host.IdentityFiles, kv.Value)
 			}
@@ -52,28 +61,303 @@ func hostFromSSHConfig(hostConfig *ssh_config.Host) (host *Host, err error) {
 	return host, nil
 }
 
-func GetHostsFromSSHConfig() (hosts []*Host, err error) {
-	hosts = make([]*Host, 0)
+var (
+	commentTagsRegex = regexp.MustCompile(`tags:([0-9a-zA-z_\-,]*)`)
+	// labels are up to the end of comment or the tags, such as "labels: env=prod, role=db"
+	commentLabelsRegex = regexp.MustCompile(`labels:\s*(.*?)\s*(?:\btags:|$)`)
+)
+
+// parseComment parses tags and labels from comment, such as "tags:web,prod labels: env=prod,role=db"
+func (host *Host) parseComment(comment string) {
+	match := commentTagsRegex.FindStringSubmatch(comment)
+	if len(match) > 1 {
+		for _, tag := range strings.Split(match[1], ",") {
+			if tag == "" {
+				continue
+			}
+			host.TagList = append(host.TagList, tag)
+		}
+	}
+
+	match = commentLabelsRegex.FindStringSubmatch(comment)
+	if len(match) > 1 {
+		labels, err := ParseLabels(match[1])
+		if err != nil {
+			logger.Warnf("host %s invalid labels: %v", host.Name(), err)
+			return
+		}
+		host.Labels = labels
+	}
+}
+
+var (
+	hostLineRegex    = regexp.MustCompile(`(?i)^\s*host(\s*=\s*|\s+)`)
+	matchLineRegex   = regexp.MustCompile(`(?i)^\s*match(\s*=\s*|\s+)`)
+	includeLineRegex = regexp.MustCompile(`(?i)^\s*include(\s*=\s*|\s+)(.*)$`)
+)
+
+const (
+	systemSSHConfigPath = "/etc/ssh/ssh_config"
+	maxIncludeDepth     = 16
+)
+
+// SSHConfigPaths are ssh config files given by "-F", they override sshConfigFiles in config
+var SSHConfigPaths []string
+
+func userSSHConfigPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".ssh", "config")
+}
+
+// SSHConfigFiles returns the user ssh config files, the first one is edited by "ds host add"
+func SSHConfigFiles() []string {
+	paths := SSHConfigPaths
+	if len(paths) == 0 {
+		paths = Config.SSHConfigFiles
+	}
+	if len(paths) == 0 {
+		return []string{userSSHConfigPath()}
+	}
+
+	files := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if expanded, err := homedir.Expand(path); err == nil {
+			path = expanded
+		}
+		files = append(files, path)
+	}
+	return files
+}
 
-	configPath := filepath.Join(os.Getenv("HOME"), ".ssh", "config")
-	if _, err := os.Stat(configPath); err != nil {
-		return hosts, nil
+// decodeSSHConfig decodes the lines with Include directives ignored, which are handled by dssh.
+// It returns the line index of Host or Match line of config.Hosts[i+1].
+func decodeSSHConfig(lines []string) (*ssh_config.Config, []int, error) {
+	var content strings.Builder
+	headers := make([]int, 0)
+	for i, line := range lines {
+		if includeLineRegex.MatchString(line) {
+			line = ""
+		}
+		// Match blocks are not supported by the decoder, they are resolved by dssh
+		if matchLineRegex.MatchString(line) {
+			line = "Host *"
+		}
+		if hostLineRegex.MatchString(line) {
+			headers = append(headers, i)
+		}
+		content.WriteString(line + "\n")
 	}
 
-	configBytes, err := os.ReadFile(configPath)
+	config, err := ssh_config.DecodeBytes([]byte(content.String()))
 	if err != nil {
-		return hosts, err
+		return nil, nil, err
+	}
+	if len(headers) != len(config.Hosts)-1 {
+		return nil, nil, fmt.Errorf("found %d Host lines, but parsed %d hosts", len(headers), len(config.Hosts)-1)
+	}
+	return config, headers, nil
+}
+
+// sshConfigLine is a line of ssh config file, Line is 0 if it's added by dssh
+type sshConfigLine struct {
+	File string
+	Line int
+	Text string
+}
+
+// sshConfig is ssh config files flattened with Include directives
+type sshConfig struct {
+	lines   []sshConfigLine
+	config  *ssh_config.Config
+	headers []int
+}
+
+// includePaths returns the files of Include directive, relative paths are in ~/.ssh or /etc/ssh
+func includePaths(file string, value string) []string {
+	baseDir := filepath.Join(os.Getenv("HOME"), ".ssh")
+	if strings.HasPrefix(filepath.Clean(file), "/etc/ssh") {
+		baseDir = "/etc/ssh"
+	}
+
+	value, _, _ = strings.Cut(value, "#")
+	paths := make([]string, 0)
+	for _, pattern := range splitFields(value) {
+		if expanded, err := homedir.Expand(pattern); err == nil {
+			pattern = expanded
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(baseDir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			logger.Warnf("%s invalid include %s: %v", file, pattern, err)
+			continue
+		}
+		paths = append(paths, matches...)
+	}
+	return paths
+}
+
+// readSSHConfig reads the file with Include directives inlined, included files in stack are skipped
+func (c *sshConfig) readSSHConfig(file string, stack []string) error {
+	if slices.Contains(stack, file) {
+		logger.Warnf("include cycle: %s -> %s, skipped", strings.Join(stack, " -> "), file)
+		return nil
+	}
+	if len(stack) >= maxIncludeDepth {
+		return fmt.Errorf("include %s too deep: %s", file, strings.Join(stack, " -> "))
 	}
+	stack = append(stack, file)
 
-	sshConfig, err := ssh_config.DecodeBytes(configBytes)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if len(stack) > 1 || os.IsNotExist(err) {
+			logger.Warnf("read ssh config failed: %v", err)
+			return nil
+		}
+		return err
+	}
+
+	header := sshConfigLine{Text: "Host *"}
+	for i, text := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		line := sshConfigLine{File: file, Line: i + 1, Text: text}
+		if hostLineRegex.MatchString(text) || matchLineRegex.MatchString(text) {
+			header = line
+		}
+
+		match := includeLineRegex.FindStringSubmatch(text)
+		if match == nil {
+			c.lines = append(c.lines, line)
+			continue
+		}
+
+		// keep the Include line, it's ignored when decoding
+		c.lines = append(c.lines, line)
+		for _, path := range includePaths(file, match[2]) {
+			start := len(c.lines)
+			if err := c.readSSHConfig(path, stack); err != nil {
+				return err
+			}
+			// restore the Host block of the Include directive
+			if slices.ContainsFunc(c.lines[start:], func(l sshConfigLine) bool {
+				return hostLineRegex.MatchString(l.Text) || matchLineRegex.MatchString(l.Text)
+			}) {
+				c.lines = append(c.lines, sshConfigLine{Text: header.Text})
+			}
+		}
+	}
+	return nil
+}
+
+// loadSSHConfig reads the files in order, each file starts from the global scope
+func loadSSHConfig(files ...string) (*sshConfig, error) {
+	c := &sshConfig{}
+	for i, file := range files {
+		if i > 0 {
+			c.lines = append(c.lines, sshConfigLine{Text: "Host *"})
+		}
+		if err := c.readSSHConfig(file, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	texts := make([]string, 0, len(c.lines))
+	for _, line := range c.lines {
+		texts = append(texts, line.Text)
+	}
+	config, headers, err := decodeSSHConfig(texts)
+	if err != nil {
+		return nil, fmt.Errorf("parse ssh config %s failed: %v", strings.Join(files, ","), err)
+	}
+	c.config, c.headers = config, headers
+	return c, nil
+}
+
+// Position returns the file and line of the decoded line number
+func (c *sshConfig) Position(line int) (string, int) {
+	if line <= 0 || line > len(c.lines) {
+		return "", 0
+	}
+	return c.lines[line-1].File, c.lines[line-1].Line
+}
+
+// hostPosition returns the file and line of Host line of config.Hosts[index]
+func (c *sshConfig) hostPosition(index int) (string, int) {
+	if index <= 0 {
+		return "", 0
+	}
+	return c.Position(c.headers[index-1] + 1)
+}
+
+// isMatchBlock reports whether config.Hosts[index] is a Match block
+func (c *sshConfig) isMatchBlock(index int) bool {
+	return index > 0 && matchLineRegex.MatchString(c.lines[c.headers[index-1]].Text)
+}
+
+// patterns returns the patterns of Host line of config.Hosts[index], negated patterns are kept
+func (c *sshConfig) patterns(index int) []string {
+	if index <= 0 || !hostLineRegex.MatchString(c.lines[c.headers[index-1]].Text) {
+		return nil
+	}
+	header, _, _ := strings.Cut(c.lines[c.headers[index-1]].Text, "#")
+	return strings.Fields(hostLineRegex.ReplaceAllString(header, ""))
+}
+
+// Files returns the ssh config files which are read, in order
+func (c *sshConfig) Files() (files []string) {
+	for _, line := range c.lines {
+		if line.File != "" && !slices.Contains(files, line.File) {
+			files = append(files, line.File)
+		}
+	}
+	return files
+}
+
+var userSSHConfig, systemSSHConfig *sshConfig
+
+// loadSSHConfigs loads the user and system ssh config once, the system config is not used with "-F"
+func loadSSHConfigs() (*sshConfig, *sshConfig, error) {
+	if userSSHConfig != nil {
+		return userSSHConfig, systemSSHConfig, nil
+	}
+
+	user, err := loadSSHConfig(SSHConfigFiles()...)
+	if err != nil {
+		return nil, nil, err
+	}
+	system := &sshConfig{config: &ssh_config.Config{}}
+	if len(SSHConfigPaths) == 0 {
+		if _, err := os.Stat(systemSSHConfigPath); err == nil {
+			if system, err = loadSSHConfig(systemSSHConfigPath); err != nil {
+				logger.Warnf("%v", err)
+				system = &sshConfig{config: &ssh_config.Config{}}
+			}
+		}
+	}
+	userSSHConfig, systemSSHConfig = user, system
+	return userSSHConfig, systemSSHConfig, nil
+}
+
+func GetHostsFromSSHConfig() (hosts []*Host, err error) {
+	hosts = make([]*Host, 0)
+
+	userConfig, _, err := loadSSHConfigs()
 	if err != nil {
 		return hosts, err
 	}
 
-	for _, hostConfig := range sshConfig.Hosts {
+	positions := make([]string, 0)
+	for index, hostConfig := range userConfig.config.Hosts {
+		// Host lines added by dssh, in the file included more than once, or Match blocks
+		file, line := userConfig.hostPosition(index)
+		position := fmt.Sprintf("%s:%d", file, line)
+		if file == "" || slices.Contains(positions, position) || userConfig.isMatchBlock(index) {
+			continue
+		}
+		positions = append(positions, position)
+
 		host, err := hostFromSSHConfig(hostConfig)
 		if err != nil {
-			return hosts, err
+			return hosts, fmt.Errorf("%s %v", position, err)
 		}
 
 		// 没有 HostName 的都是正则类型的配置
@@ -84,18 +368,9 @@ func GetHostsFromSSHConfig() (hosts []*Host, err error) {
 		// 从正则配置中解析
 		host.FillAttrsWithSSHConfig()
 
-		// tags
+		// tags and labels
 		if hostConfig.EOLComment != "" {
-			tagsRegex := regexp.MustCompile(`tags:([0-9a-zA-z_\-,]*)`)
-			match := tagsRegex.FindStringSubmatch(hostConfig.EOLComment)
-			if len(match) > 1 {
-				for _, tag := range strings.Split(match[1], ",") {
-					if tag == "" {
-						continue
-					}
-					host.TagList = append(host.TagList, tag)
-				}
-			}
+			host.parseComment(hostConfig.EOLComment)
 		}
 
 		logger.Debugf("host: %+#v", host)
@@ -106,7 +381,7 @@ func GetHostsFromSSHConfig() (hosts []*Host, err error) {
 }
 
 func GetHostNames() (names []string) {
-	hosts, err := GetHostsFromSSHConfig()
+	hosts, err := GetHosts()
 	if err != nil {
 		return nil
 	}
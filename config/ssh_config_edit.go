@@ -0,0 +1,381 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+
+	"github.com/PWZER/dssh/utils"
+)
+
+var (
+	tagRegex = regexp.MustCompile(`^[0-9a-zA-Z_\-]+$`)
+)
+
+// editable options of Host block
+var hostOptionKeys = []string{"HostName", "User", "Port", "ProxyJump", "IdentityFile"}
+
+// sshConfigFile edits ssh config by lines, the AST locates the Host blocks and options,
+// so the lines not edited are kept as they are.
+type sshConfigFile struct {
+	path    string
+	lines   []string
+	config  *ssh_config.Config
+	headers []int // line index of Host line of config.Hosts[i+1]
+}
+
+func loadSSHConfigFile(path string) (*sshConfigFile, error) {
+	file := &sshConfigFile{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	content := strings.TrimSuffix(string(data), "\n")
+	if content != "" {
+		file.lines = strings.Split(content, "\n")
+	}
+	if err := file.reload(); err != nil {
+		return nil, fmt.Errorf("parse %s failed: %v", path, err)
+	}
+	return file, nil
+}
+
+func (f *sshConfigFile) reload() (err error) {
+	f.config, f.headers, err = decodeSSHConfig(f.lines)
+	return err
+}
+
+func (f *sshConfigFile) String() string {
+	if len(f.lines) == 0 {
+		return ""
+	}
+	return strings.Join(f.lines, "\n") + "\n"
+}
+
+// patterns returns the patterns in Host line, the parsed patterns lose the "!" of negated patterns
+func (f *sshConfigFile) patterns(index int) []string {
+	if !hostLineRegex.MatchString(f.lines[f.header(index)]) {
+		return nil
+	}
+	header, _, _ := strings.Cut(f.lines[f.header(index)], "#")
+	return strings.Fields(hostLineRegex.ReplaceAllString(header, ""))
+}
+
+// findHost returns the index of Host block in config.Hosts which has the pattern, or -1
+func (f *sshConfigFile) findHost(name string) int {
+	for i := 1; i < len(f.config.Hosts); i++ {
+		if slices.Contains(f.patterns(i), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *sshConfigFile) header(index int) int {
+	return f.headers[index-1]
+}
+
+// splice replaces lines in remove with lines inserted at position, then reloads the config
+func (f *sshConfigFile) splice(position int, remove []int, inserted []string) error {
+	lines := make([]string, 0, len(f.lines)+len(inserted))
+	for i, line := range f.lines {
+		if i == position {
+			lines = append(lines, inserted...)
+		}
+		if slices.Contains(remove, i) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if position >= len(f.lines) {
+		lines = append(lines, inserted...)
+	}
+	f.lines = lines
+	return f.reload()
+}
+
+func leadingSpace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// setOption replaces all the key options of the Host block with values, values are
+// added after the last option if the key is not set, no values to unset the key.
+func (f *sshConfigFile) setOption(index int, key string, values ...string) error {
+	host := f.config.Hosts[index]
+	position, last, indent, comment := -1, f.header(index), "", ""
+	remove := make([]int, 0)
+	for _, node := range host.Nodes {
+		kv, ok := node.(*ssh_config.KV)
+		if !ok {
+			continue
+		}
+		line := kv.Pos().Line - 1
+		last = max(last, line)
+		if indent == "" {
+			indent = leadingSpace(f.lines[line])
+		}
+		if !strings.EqualFold(kv.Key, key) {
+			continue
+		}
+		remove = append(remove, line)
+		if position < 0 {
+			position, comment = line, kv.Comment
+			indent = leadingSpace(f.lines[line])
+		}
+	}
+	if indent == "" {
+		indent = "    "
+	}
+	if position < 0 {
+		position = last + 1
+	}
+
+	inserted := make([]string, 0, len(values))
+	for i, value := range values {
+		line := fmt.Sprintf("%s%s %s", indent, key, value)
+		if i == 0 && comment != "" {
+			line += " #" + comment
+		}
+		inserted = append(inserted, line)
+	}
+	return f.splice(position, remove, inserted)
+}
+
+// setComment replaces the end of line comment of Host line
+func (f *sshConfigFile) setComment(index int, comment string) error {
+	line := f.header(index)
+	header, _, _ := strings.Cut(f.lines[line], "#")
+	header = strings.TrimRight(header, " \t")
+	if strings.TrimSpace(comment) != "" {
+		header += " #" + comment
+	}
+	return f.splice(line, []int{line}, []string{header})
+}
+
+// removeHost removes the Host block until its last option, and a blank line after it
+func (f *sshConfigFile) removeHost(index int) error {
+	start, end := f.header(index), f.header(index)
+	for _, node := range f.config.Hosts[index].Nodes {
+		if _, ok := node.(*ssh_config.KV); ok {
+			end = max(end, node.Pos().Line-1)
+		}
+	}
+	if end+1 < len(f.lines) && strings.TrimSpace(f.lines[end+1]) == "" {
+		end++
+	}
+
+	remove := make([]int, 0, end-start+1)
+	for i := start; i <= end; i++ {
+		remove = append(remove, i)
+	}
+	return f.splice(start, remove, nil)
+}
+
+// appendBlock appends the Host block with a blank line before it
+func (f *sshConfigFile) appendBlock(block string) error {
+	lines := strings.Split(strings.TrimSuffix(block, "\n"), "\n")
+	if len(f.lines) > 0 && strings.TrimSpace(f.lines[len(f.lines)-1]) != "" {
+		lines = append([]string{""}, lines...)
+	}
+	return f.splice(len(f.lines), nil, lines)
+}
+
+// save writes the file atomically, the original file is kept as "<path>.bak"
+func (f *sshConfigFile) save() error {
+	return utils.WriteFileAtomic(f.path, []byte(f.String()))
+}
+
+// findHostFile loads the first ssh config file which has the Host block of name
+func findHostFile(name string) (*sshConfigFile, int, error) {
+	userConfig, _, err := loadSSHConfigs()
+	if err != nil {
+		return nil, -1, err
+	}
+	for _, path := range userConfig.Files() {
+		file, err := loadSSHConfigFile(path)
+		if err != nil {
+			return nil, -1, err
+		}
+		if index := file.findHost(name); index >= 0 {
+			return file, index, nil
+		}
+	}
+	return nil, -1, fmt.Errorf("host %s not found in %s", name, strings.Join(userConfig.Files(), ","))
+}
+
+// editHost edits the Host block of name in the ssh config file which has it, and saves the file
+func editHost(name string, edit func(file *sshConfigFile, index int) error) error {
+	file, index, err := findHostFile(name)
+	if err != nil {
+		return err
+	}
+	if err := edit(file, index); err != nil {
+		return err
+	}
+	return file.save()
+}
+
+func validateTags(tags []string) error {
+	for _, tag := range tags {
+		if !tagRegex.MatchString(tag) {
+			return fmt.Errorf("invalid tag: %q", tag)
+		}
+	}
+	return nil
+}
+
+// AddHost adds the Host block to the first ssh config file
+func AddHost(name string, hostConfig *InventoryHostConfig) error {
+	if name == "" || strings.ContainsAny(name, "*!? \t#") {
+		return fmt.Errorf("invalid host name: %q", name)
+	}
+	if hostConfig.HostName == "" {
+		return fmt.Errorf("hostname is required non-empty string!")
+	}
+	if err := validateTags(hostConfig.Tags); err != nil {
+		return err
+	}
+
+	if file, _, err := findHostFile(name); err == nil {
+		return fmt.Errorf("host %s already exists in %s", name, file.path)
+	}
+	file, err := loadSSHConfigFile(SSHConfigFiles()[0])
+	if err != nil {
+		return err
+	}
+	if err := file.appendBlock(sshConfigBlock(name, hostConfig)); err != nil {
+		return err
+	}
+	return file.save()
+}
+
+// RemoveHosts removes the Host blocks, only the name is removed if the block has other patterns
+func RemoveHosts(names ...string) error {
+	for _, name := range names {
+		err := editHost(name, func(file *sshConfigFile, index int) error {
+			patterns := slices.DeleteFunc(file.patterns(index), func(pattern string) bool {
+				return pattern == name
+			})
+			// a block with only negated patterns matches nothing
+			if !slices.ContainsFunc(patterns, func(pattern string) bool { return !strings.HasPrefix(pattern, "!") }) {
+				return file.removeHost(index)
+			}
+			return file.setPatterns(index, patterns)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setPatterns replaces the patterns of Host line, the comment is kept
+func (f *sshConfigFile) setPatterns(index int, patterns []string) error {
+	line := f.header(index)
+	_, comment, found := strings.Cut(f.lines[line], "#")
+	header := "Host " + strings.Join(patterns, " ")
+	if found {
+		header += " #" + comment
+	}
+	return f.splice(line, []int{line}, []string{header})
+}
+
+// SetHost sets the not empty options of the Host block, and removes the unset options
+func SetHost(name string, hostConfig *InventoryHostConfig, unset []string) error {
+	options := map[string][]string{}
+	if hostConfig.HostName != "" {
+		options["HostName"] = []string{hostConfig.HostName}
+	}
+	if hostConfig.User != "" {
+		options["User"] = []string{hostConfig.User}
+	}
+	if hostConfig.Port != 0 {
+		options["Port"] = []string{strconv.Itoa(int(hostConfig.Port))}
+	}
+	if hostConfig.ProxyJump != "" {
+		options["ProxyJump"] = []string{hostConfig.ProxyJump}
+	}
+	if len(hostConfig.IdentityFiles) > 0 {
+		options["IdentityFile"] = hostConfig.IdentityFiles
+	}
+	for _, key := range unset {
+		index := slices.IndexFunc(hostOptionKeys, func(k string) bool { return strings.EqualFold(k, key) })
+		if index < 0 {
+			return fmt.Errorf("invalid option: %s, allowed ( %s )", key, strings.Join(hostOptionKeys, ", "))
+		}
+		if _, ok := options[hostOptionKeys[index]]; ok {
+			return fmt.Errorf("option %s is both set and unset", hostOptionKeys[index])
+		}
+		options[hostOptionKeys[index]] = nil
+	}
+	if len(options) == 0 {
+		return fmt.Errorf("nothing to set")
+	}
+
+	return editHost(name, func(file *sshConfigFile, index int) error {
+		for _, key := range hostOptionKeys {
+			values, ok := options[key]
+			if !ok {
+				continue
+			}
+			if err := file.setOption(index, key, values...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// commentWithTags replaces the tags in the end of line comment, such as " tags:web,prod labels: env=prod"
+func commentWithTags(comment string, tags []string) string {
+	value := ""
+	if len(tags) > 0 {
+		value = "tags:" + strings.Join(tags, ",")
+	}
+	if commentTagsRegex.MatchString(comment) {
+		comment = commentTagsRegex.ReplaceAllLiteralString(comment, value)
+	} else {
+		comment += " " + value
+	}
+	if fields := strings.Fields(comment); len(fields) > 0 {
+		return " " + strings.Join(fields, " ")
+	}
+	return ""
+}
+
+func (f *sshConfigFile) hostTags(index int) []string {
+	host := &Host{}
+	host.parseComment(f.config.Hosts[index].EOLComment)
+	return host.TagList
+}
+
+// TagHost adds tags to the Host block
+func TagHost(name string, tags ...string) error {
+	if err := validateTags(tags); err != nil {
+		return err
+	}
+	return editHost(name, func(file *sshConfigFile, index int) error {
+		hostTags := file.hostTags(index)
+		for _, tag := range tags {
+			if !slices.Contains(hostTags, tag) {
+				hostTags = append(hostTags, tag)
+			}
+		}
+		return file.setComment(index, commentWithTags(file.config.Hosts[index].EOLComment, hostTags))
+	})
+}
+
+// UntagHost removes tags from the Host block
+func UntagHost(name string, tags ...string) error {
+	return editHost(name, func(file *sshConfigFile, index int) error {
+		hostTags := slices.DeleteFunc(file.hostTags(index), func(tag string) bool {
+			return slices.Contains(tags, tag)
+		})
+		return file.setComment(index, commentWithTags(file.config.Hosts[index].EOLComment, hostTags))
+	})
+}
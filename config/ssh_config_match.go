@@ -0,0 +1,321 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	osuser "os/user"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kevinburke/ssh_config"
+
+	"github.com/PWZER/dssh/logger"
+)
+
+// options which can be given many times, all values are used
+var multiValueOptions = []string{
+	"identityfile", "certificatefile", "localforward", "remoteforward", "dynamicforward", "sendenv", "setenv",
+}
+
+// sshOptions are the resolved options, the key is lower case
+type sshOptions map[string][]string
+
+func (options sshOptions) get(key string) string {
+	if values := options[strings.ToLower(key)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// matchContext is the connection to resolve options for
+type matchContext struct {
+	originalHost string
+	user         string // remote user given by user
+	final        bool
+}
+
+func localUsername() string {
+	if u, err := osuser.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// matchPatternList matches the comma separated pattern list, such as "*.internal,!bastion.internal"
+func matchPatternList(value, patterns string) bool {
+	matched := false
+	for _, pattern := range strings.Split(patterns, ",") {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(value)); !ok {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// matchHostPatterns matches the patterns of Host line, the patterns are separated by spaces
+func matchHostPatterns(alias string, patterns []string) bool {
+	return matchPatternList(alias, strings.Join(patterns, ","))
+}
+
+func (ctx *matchContext) hostname(options sshOptions) string {
+	if hostname := options.get("HostName"); hostname != "" {
+		return hostname
+	}
+	return ctx.originalHost
+}
+
+func (ctx *matchContext) remoteUser(options sshOptions) string {
+	if ctx.user != "" {
+		return ctx.user
+	}
+	if user := options.get("User"); user != "" {
+		return user
+	}
+	return localUsername()
+}
+
+// expandTokens expands the tokens of Match exec, such as %h, %p, %r
+func (ctx *matchContext) expandTokens(command string, options sshOptions) string {
+	port := options.get("Port")
+	if port == "" {
+		port = "22"
+	}
+	localHost, _ := os.Hostname()
+	homeDir, _ := os.UserHomeDir()
+	replacer := strings.NewReplacer(
+		"%%", "%",
+		"%h", ctx.hostname(options),
+		"%n", ctx.originalHost,
+		"%p", port,
+		"%r", ctx.remoteUser(options),
+		"%u", localUsername(),
+		"%l", localHost,
+		"%L", strings.Split(localHost, ".")[0],
+		"%d", homeDir,
+	)
+	return replacer.Replace(command)
+}
+
+// MatchExec enables the commands of Match exec, it's set when resolving hosts to connect,
+// so that listing and completing hosts don't run commands, the exec criteria don't match then
+var MatchExec bool
+
+var (
+	matchExecCache = make(map[string]bool)
+	matchExecMutex sync.Mutex
+)
+
+// matchExec runs the command with shell, it matches if the command exits with 0
+func matchExec(command string) bool {
+	matchExecMutex.Lock()
+	defer matchExecMutex.Unlock()
+	if result, ok := matchExecCache[command]; ok {
+		return result
+	}
+	err := exec.Command("/bin/sh", "-c", command).Run()
+	logger.Debugf("match exec %q: %v", command, err)
+	matchExecCache[command] = err == nil
+	return err == nil
+}
+
+// matchCriteria evaluates the criteria of Match line, all criteria must match
+func (ctx *matchContext) matchCriteria(args []string, options sshOptions) (bool, error) {
+	for i := 0; i < len(args); i++ {
+		criterion := strings.ToLower(args[i])
+		negated := strings.HasPrefix(criterion, "!")
+		criterion = strings.TrimPrefix(criterion, "!")
+
+		var matched bool
+		switch criterion {
+		case "all":
+			matched = true
+		case "canonical", "final":
+			// there is no hostname canonicalization, both match in the final pass
+			matched = ctx.final
+		default:
+			if i+1 >= len(args) {
+				return false, fmt.Errorf("missing argument of Match %s", criterion)
+			}
+			i++
+			switch criterion {
+			case "host":
+				matched = matchPatternList(ctx.hostname(options), args[i])
+			case "originalhost":
+				matched = matchPatternList(ctx.originalHost, args[i])
+			case "user":
+				matched = matchPatternList(ctx.remoteUser(options), args[i])
+			case "localuser":
+				matched = matchPatternList(localUsername(), args[i])
+			case "tagged":
+				matched = matchPatternList(options.get("Tag"), args[i])
+			case "exec":
+				if !MatchExec {
+					return false, nil
+				}
+				// the command is not run if a previous criterion did not match
+				matched = matchExec(ctx.expandTokens(args[i], options))
+			case "localnetwork":
+				matched = false
+			default:
+				return false, fmt.Errorf("unsupported Match criterion: %s", criterion)
+			}
+		}
+		if matched == negated {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// parseOptionLine splits the line to lower case key, raw value and fields of value
+func parseOptionLine(text string) (key string, value string, args []string) {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.HasPrefix(text, "#") {
+		return "", "", nil
+	}
+	end := strings.IndexAny(text, " \t=")
+	if end < 0 {
+		return strings.ToLower(text), "", nil
+	}
+	key = strings.ToLower(text[:end])
+	value = strings.TrimLeft(text[end:], " \t")
+	value = strings.TrimLeft(strings.TrimPrefix(value, "="), " \t")
+
+	// end of line comment, such as "Host web-01 # tags:web"
+	if index := strings.Index(value, " #"); index >= 0 {
+		value = value[:index]
+	} else if index := strings.Index(value, "\t#"); index >= 0 {
+		value = value[:index]
+	}
+	value = strings.TrimSpace(value)
+	args = splitFields(value)
+	if len(args) == 1 {
+		value = args[0]
+	}
+	return key, value, args
+}
+
+// hasFinal reports whether the config has "Match final" or "Match canonical", which needs the final pass
+func (c *sshConfig) hasFinal() bool {
+	for _, line := range c.lines {
+		key, _, args := parseOptionLine(line.Text)
+		if key != "match" {
+			continue
+		}
+		for _, arg := range args {
+			if arg = strings.ToLower(strings.TrimPrefix(arg, "!")); arg == "final" || arg == "canonical" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolve walks the lines like ssh, the first value of an option is used
+func (c *sshConfig) resolve(ctx *matchContext, options sshOptions) {
+	active := true
+	for _, line := range c.lines {
+		key, value, args := parseOptionLine(line.Text)
+		switch key {
+		case "":
+			continue
+		case "include":
+			// included files are inlined
+			continue
+		case "host":
+			active = matchHostPatterns(ctx.originalHost, args)
+			continue
+		case "match":
+			matched, err := ctx.matchCriteria(args, options)
+			if err != nil {
+				logger.Warnf("%s:%d %v", line.File, line.Line, err)
+			}
+			active = matched
+			continue
+		}
+		if !active {
+			continue
+		}
+
+		if key == "hostname" {
+			value = strings.NewReplacer("%%", "%", "%h", ctx.originalHost).Replace(value)
+		}
+		if slices.Contains(multiValueOptions, key) {
+			// like ssh, the same value is added once, the final pass reads the blocks again
+			if !slices.Contains(options[key], value) {
+				options[key] = append(options[key], value)
+			}
+		} else if _, ok := options[key]; !ok {
+			options[key] = []string{value}
+		}
+	}
+}
+
+type resolveKey struct {
+	alias string
+	user  string
+}
+
+var (
+	resolveCache = make(map[resolveKey]sshOptions)
+	resolveMutex sync.Mutex
+)
+
+// resolveSSHOptions resolves the options of alias like ssh, with Host and Match blocks in user and system config
+func resolveSSHOptions(alias, user string) sshOptions {
+	resolveMutex.Lock()
+	defer resolveMutex.Unlock()
+	if options, ok := resolveCache[resolveKey{alias, user}]; ok {
+		return options
+	}
+
+	options := make(sshOptions)
+	userConfig, systemConfig, err := loadSSHConfigs()
+	if err != nil {
+		logger.Warnf("%v", err)
+		return options
+	}
+
+	ctx := &matchContext{originalHost: alias, user: user}
+	configs := []*sshConfig{userConfig, systemConfig}
+	for _, c := range configs {
+		c.resolve(ctx, options)
+	}
+	if userConfig.hasFinal() || systemConfig.hasFinal() {
+		ctx.final = true
+		for _, c := range configs {
+			c.resolve(ctx, options)
+		}
+	}
+
+	resolveCache[resolveKey{alias, user}] = options
+	return options
+}
+
+// sshConfigGet returns the value of key for alias, like ssh_config.Get with Match blocks
+func sshConfigGet(alias, user, key string) string {
+	if value := resolveSSHOptions(alias, user).get(key); value != "" {
+		return value
+	}
+	return ssh_config.Default(key)
+}
+
+// sshConfigGetAll returns all values of key for alias, like ssh_config.GetAll with Match blocks
+func sshConfigGetAll(alias, user, key string) []string {
+	if values := resolveSSHOptions(alias, user)[strings.ToLower(key)]; len(values) > 0 {
+		return values
+	}
+	if value := ssh_config.Default(key); value != "" {
+		return []string{value}
+	}
+	return nil
+}
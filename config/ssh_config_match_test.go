@@ -0,0 +1,43 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestResolveSSHOptionsMatchFinal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	content := `Host web-01
+    HostName 10.0.0.11
+    LocalForward 8080 localhost:80
+    IdentityFile ~/.ssh/id_web
+
+Match final host 10.0.0.11
+    User deploy
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	SSHConfigPaths = []string{path}
+	userSSHConfig, systemSSHConfig = nil, nil
+	resolveCache = make(map[resolveKey]sshOptions)
+	t.Cleanup(func() {
+		SSHConfigPaths = nil
+		userSSHConfig, systemSSHConfig = nil, nil
+		resolveCache = make(map[resolveKey]sshOptions)
+	})
+
+	options := resolveSSHOptions("web-01", "")
+	if got := options["localforward"]; !slices.Equal(got, []string{"8080 localhost:80"}) {
+		t.Errorf("LocalForward = %q, want once", got)
+	}
+	if got := options["identityfile"]; !slices.Equal(got, []string{"~/.ssh/id_web"}) {
+		t.Errorf("IdentityFile = %q, want once", got)
+	}
+	if got := options.get("User"); got != "deploy" {
+		t.Errorf("User = %q, want deploy from Match final", got)
+	}
+}
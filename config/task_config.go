@@ -2,24 +2,87 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
-	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
+const (
+	OutputStream = "stream"
+	OutputPrefix = "prefix"
+	OutputBuffer = "buffer"
+	OutputGroup  = "group"
+
+	ReportTable = "table"
+	ReportJSON  = "json"
+	ReportNone  = "none"
+)
+
+// connect errors classes which can be retried
+const (
+	RetryOnTimeout     = "timeout"
+	RetryOnRefused     = "refused"
+	RetryOnReset       = "reset"
+	RetryOnUnreachable = "unreachable"
+	RetryOnHandshake   = "handshake"
+	RetryOnAuth        = "auth"
+)
+
+var DefaultRetryOn = []string{RetryOnTimeout, RetryOnRefused, RetryOnReset, RetryOnUnreachable, RetryOnHandshake}
+
+// RetryPolicy controls retries when dialing and handshaking each hop
+type RetryPolicy struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	RetryOn    []string
+}
+
+// Delay returns the exponential backoff before the next attempt, attempt starts from 1
+func (policy *RetryPolicy) Delay(attempt int) time.Duration {
+	delay := policy.Backoff
+	for i := 1; i < attempt && delay < policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if policy.MaxBackoff > 0 {
+		delay = min(delay, policy.MaxBackoff)
+	}
+	return delay
+}
+
+func (policy *RetryPolicy) validate() error {
+	if policy.Attempts < 1 {
+		return fmt.Errorf("invalid connect attempts: %d", policy.Attempts)
+	}
+	for _, class := range policy.RetryOn {
+		switch class {
+		case RetryOnTimeout, RetryOnRefused, RetryOnReset, RetryOnUnreachable, RetryOnHandshake, RetryOnAuth:
+		default:
+			return fmt.Errorf("invalid retry on: %s", class)
+		}
+	}
+	return nil
+}
+
 type Task struct {
-	Index        int
-	Target       *Host
-	Command      string
-	RemoteListen string
-	ProxyServer  string
-	Message      string
-	Outputer     string
-	UploadSrc    string
-	UploadDest   string
-	DownloadSrc  string
-	DownloadDest string
+	Index          int
+	Origin         string // target string given by user or host pattern
+	Target         *Host
+	Command        string
+	RemoteListen   string
+	ProxyServer    string
+	Message        string
+	Outputer       string
+	UploadSrc      string
+	UploadDest     string
+	DownloadSrc    string
+	DownloadDest   string
+	Timeout        time.Duration
+	ConnectTimeout time.Duration
+	Retry          *RetryPolicy
 }
 
 func (task *Task) ParseCommand(command, script, module string) error {
@@ -53,6 +116,7 @@ type TaskConfig struct {
 	ProxyJump      string
 	IdentityFiles  []string
 	Tags           []string
+	Labels         []string
 	Targets        []string
 	RemoteListen   string
 	ProxyServer    string
@@ -65,6 +129,22 @@ type TaskConfig struct {
 	DownloadDest   string
 	FailedContinue bool
 	Parallel       int
+	Batch          string
+	BatchPause     time.Duration
+	BatchConfirm   bool
+	BatchMode      bool // fail hosts asking for password, passphrase or confirmation
+	ReusePassword  bool // reuse password for hosts of the same user and tag or jump
+	MaxFail        string
+	Timeout        time.Duration
+	ConnectTimeout time.Duration
+	Retry          RetryPolicy
+	Preflight      bool
+	Template       bool
+	Vars           map[string]string
+	Output         string
+	OutputDir      string
+	Report         string
+	ReportFile     string
 	Tasks          []*Task
 }
 
@@ -75,63 +155,152 @@ func NewTaskConfig() *TaskConfig {
 		IdentityFiles:  []string{},
 		Parallel:       1,
 		FailedContinue: false,
+		Output:         OutputStream,
+		Report:         ReportTable,
+		Retry: RetryPolicy{
+			Attempts:   1,
+			Backoff:    time.Second,
+			MaxBackoff: 30 * time.Second,
+			RetryOn:    DefaultRetryOn,
+		},
 	}
 }
 
-func (cfg *TaskConfig) addTask(target string) (err error) {
-	host, err := NewHost(cfg.Username, target, cfg.Port, cfg.ProxyJump, cfg.IdentityFiles)
+// parseCount parses "N" or "N%" of total, percent is rounded up and at least 1
+func parseCount(value string, total int) (int, error) {
+	value = strings.TrimSpace(value)
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return 0, fmt.Errorf("invalid percent: %s", value)
+		}
+		return max(int(math.Ceil(float64(total)*p/100)), 1), nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid count: %s", value)
+	}
+	return n, nil
+}
+
+// Batches splits tasks into rolling batches, such as "1,5,25%", the last size repeats until all tasks are done
+func (cfg *TaskConfig) Batches() ([][]*Task, error) {
+	if cfg.Batch == "" {
+		return [][]*Task{cfg.Tasks}, nil
+	}
+
+	sizes := make([]int, 0)
+	for _, value := range strings.Split(cfg.Batch, ",") {
+		size, err := parseCount(value, len(cfg.Tasks))
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch: %s, %v", cfg.Batch, err)
+		}
+		sizes = append(sizes, size)
+	}
+
+	batches := make([][]*Task, 0)
+	for i, start := 0, 0; start < len(cfg.Tasks); i++ {
+		end := min(start+sizes[min(i, len(sizes)-1)], len(cfg.Tasks))
+		batches = append(batches, cfg.Tasks[start:end])
+		start = end
+	}
+	return batches, nil
+}
+
+// MaxFailCount returns the failed hosts count to abort the run, 0 means no limit
+func (cfg *TaskConfig) MaxFailCount() (int, error) {
+	if cfg.MaxFail == "" {
+		return 0, nil
+	}
+	count, err := parseCount(cfg.MaxFail, len(cfg.Tasks))
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("invalid max fail: %s, %v", cfg.MaxFail, err)
 	}
+	return count, nil
+}
 
+func (cfg *TaskConfig) appendTask(origin string, host *Host) error {
 	task := &Task{
-		Index:        len(cfg.Tasks),
-		Target:       host,
-		RemoteListen: cfg.RemoteListen,
-		ProxyServer:  cfg.ProxyServer,
-		UploadSrc:    cfg.UploadSrc,
-		UploadDest:   cfg.UploadDest,
-		DownloadSrc:  cfg.DownloadSrc,
-		DownloadDest: cfg.DownloadDest,
-	}
-	if err = task.ParseCommand(cfg.Command, cfg.Script, cfg.Module); err != nil {
+		Index:          len(cfg.Tasks),
+		Origin:         origin,
+		Target:         host,
+		RemoteListen:   cfg.RemoteListen,
+		ProxyServer:    cfg.ProxyServer,
+		Outputer:       cfg.Output,
+		UploadSrc:      cfg.UploadSrc,
+		UploadDest:     cfg.UploadDest,
+		DownloadSrc:    cfg.DownloadSrc,
+		DownloadDest:   cfg.DownloadDest,
+		Timeout:        cfg.Timeout,
+		ConnectTimeout: cfg.ConnectTimeout,
+		Retry:          &cfg.Retry,
+	}
+	if err := task.ParseCommand(cfg.Command, cfg.Script, cfg.Module); err != nil {
 		return err
 	}
+	for _, hop := range append(host.JumpList, host) {
+		hop.BatchMode = hop.BatchMode || cfg.BatchMode
+		hop.ReusePassword = cfg.ReusePassword
+	}
 	cfg.Tasks = append(cfg.Tasks, task)
 	return nil
 }
 
+func (cfg *TaskConfig) addTask(target string) (err error) {
+	host, err := NewHost(cfg.Username, target, cfg.Port, cfg.ProxyJump, cfg.IdentityFiles)
+	if err != nil {
+		return err
+	}
+	return cfg.appendTask(target, host)
+}
+
 func (cfg *TaskConfig) InitTasks() error {
-	if len(cfg.Tags) > 0 {
-		for _, tag := range cfg.Tags {
-			if matched, err := regexp.MatchString(`[0-9a-zA-z_\-,]*`, tag); err != nil || !matched {
-				return fmt.Errorf("invalid tags: %s", tag)
+	// the hosts are resolved to connect
+	MatchExec = true
+	switch cfg.Output {
+	case OutputStream, OutputPrefix, OutputBuffer, OutputGroup:
+	default:
+		return fmt.Errorf("invalid output mode: %s", cfg.Output)
+	}
+	switch cfg.Report {
+	case ReportTable, ReportJSON, ReportNone:
+	default:
+		return fmt.Errorf("invalid report format: %s", cfg.Report)
+	}
+	if err := cfg.Retry.validate(); err != nil {
+		return err
+	}
+
+	if len(cfg.Tags) > 0 || len(cfg.Labels) > 0 {
+		var tagSelector *TagSelector
+		var labelSelector *LabelSelector
+		var err error
+		if len(cfg.Tags) > 0 {
+			if tagSelector, err = ParseTagSelector(cfg.Tags...); err != nil {
+				return err
+			}
+		}
+		if len(cfg.Labels) > 0 {
+			if labelSelector, err = ParseLabelSelector(cfg.Labels...); err != nil {
+				return err
 			}
 		}
 
-		hosts, err := GetHostsFromSSHConfig()
+		hosts, err := GetHosts()
 		if err != nil {
 			return err
 		}
 
 		for _, host := range hosts {
-			if !host.MatchTags(cfg.Tags) {
+			if tagSelector != nil && !host.MatchTags(tagSelector) {
 				continue
 			}
-			task := &Task{
-				Index:        len(cfg.Tasks),
-				Target:       host,
-				RemoteListen: cfg.RemoteListen,
-				ProxyServer:  cfg.ProxyServer,
-				UploadSrc:    cfg.UploadSrc,
-				UploadDest:   cfg.UploadDest,
-				DownloadSrc:  cfg.DownloadSrc,
-				DownloadDest: cfg.DownloadDest,
+			if labelSelector != nil && !host.MatchLabels(labelSelector) {
+				continue
 			}
-			if err = task.ParseCommand(cfg.Command, cfg.Script, cfg.Module); err != nil {
+			if err = cfg.appendTask(host.Name(), host); err != nil {
 				return err
 			}
-			cfg.Tasks = append(cfg.Tasks, task)
 		}
 	} else {
 		for _, target := range cfg.Targets {
@@ -142,5 +311,18 @@ func (cfg *TaskConfig) InitTasks() error {
 			}
 		}
 	}
+
+	if cfg.Template {
+		if err := cfg.renderTasks(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := cfg.Batches(); err != nil {
+		return err
+	}
+	if _, err := cfg.MaxFailCount(); err != nil {
+		return err
+	}
 	return nil
 }
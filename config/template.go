@@ -0,0 +1,124 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// TemplateData is the data to render command, script and module content,
+// such as {{.HostName}}, {{.Username}}, {{.Port}}, {{.Name}}, {{.Index}}, {{.Labels.key}} and {{.Vars.key}}
+type TemplateData struct {
+	*Host
+	Index int
+	Total int
+	Vars  map[string]string
+}
+
+var templateFuncs = template.FuncMap{
+	"join":    strings.Join,
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"replace": strings.ReplaceAll,
+}
+
+// HostVars merges variables for the host, later ones override earlier ones:
+// host labels, hostVars in config file matched by host patterns, host's own vars, extra vars
+func HostVars(host *Host, extraVars map[string]string) map[string]string {
+	vars := maps.Clone(host.Labels)
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	for pattern, patternVars := range Config.HostVars {
+		for _, name := range append([]string{host.HostName}, host.Patterns...) {
+			if matched, _ := filepath.Match(pattern, name); matched {
+				maps.Copy(vars, patternVars)
+				break
+			}
+		}
+	}
+	maps.Copy(vars, host.Vars)
+	maps.Copy(vars, extraVars)
+	return vars
+}
+
+// PasswordCommand renders the command of the longest pattern in passwordCommands matching the host,
+// {{host}} and {{user}} are the shell quoted host name and username, it's empty if no pattern matches
+func PasswordCommand(host *Host) (string, error) {
+	longest := ""
+	for pattern := range Config.PasswordCommands {
+		if len(pattern) < len(longest) || (len(pattern) == len(longest) && pattern > longest) {
+			continue
+		}
+		for _, name := range append([]string{host.HostName}, host.Patterns...) {
+			if matched, _ := filepath.Match(pattern, name); matched {
+				longest = pattern
+				break
+			}
+		}
+	}
+	command := Config.PasswordCommands[longest]
+	if command == "" {
+		return "", nil
+	}
+
+	// the names may come from inventory plugins, only the shell quoted host name and username are rendered
+	funcs := template.FuncMap{
+		"host": func() string { return shellQuote(host.Name()) },
+		"user": func() string { return shellQuote(host.Username) },
+	}
+	tmpl, err := template.New(host.Name()).Funcs(funcs).Option("missingkey=error").Parse(command)
+	if err != nil {
+		return "", fmt.Errorf("render password command for %s failed: %v", host.Name(), err)
+	}
+	var builder strings.Builder
+	if err := tmpl.Execute(&builder, nil); err != nil {
+		return "", fmt.Errorf("render password command for %s failed: %v", host.Name(), err)
+	}
+	return builder.String(), nil
+}
+
+// shellQuote quotes the value with single quotes for /bin/sh
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+func renderTemplate(name, content string, data *TemplateData) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+	if err := tmpl.Execute(&builder, data); err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
+
+// renderTasks renders all tasks' command, errors of all hosts are reported together
+func (cfg *TaskConfig) renderTasks() error {
+	errs := make([]error, 0)
+	for _, task := range cfg.Tasks {
+		if task.Command == "" {
+			continue
+		}
+
+		data := &TemplateData{
+			Host:  task.Target,
+			Index: task.Index,
+			Total: len(cfg.Tasks),
+			Vars:  HostVars(task.Target, cfg.Vars),
+		}
+		command, err := renderTemplate(task.Target.Name(), task.Command, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("render command for %s failed: %v", task.Target.Name(), err))
+			continue
+		}
+		task.Command = command
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,284 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/PWZER/dssh/utils"
+)
+
+// VaultPasswordEnv is the environment variable of vault password, used instead of prompting
+const VaultPasswordEnv = "DSSH_VAULT_PASSWORD"
+
+const (
+	VaultPassword   = "password"
+	VaultPassphrase = "passphrase"
+)
+
+const (
+	vaultVersion = 1
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+)
+
+var ErrVaultNotFound = errors.New("vault not found, create it with \"ds vault init\"")
+
+// vaultFile is the encrypted file, the key is derived from password by scrypt, data is sealed by NaCl secretbox
+type vaultFile struct {
+	Version int    `json:"version"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Vault keeps passwords by host name or pattern, such as "web-*" or "deploy@web-*",
+// and passphrases by identity file
+type Vault struct {
+	Passwords   map[string]string `json:"passwords"`
+	Passphrases map[string]string `json:"passphrases"`
+
+	path string
+	key  [32]byte
+	// the scrypt parameters and salt of the key, kept as read to write back
+	salt    []byte
+	n, r, p int
+}
+
+func VaultPath() string {
+	vaultPath := Config.VaultFile
+	if vaultPath == "" {
+		homeDir, _ := homedir.Dir()
+		return path.Join(homeDir, ".dssh", "vault")
+	}
+	if expanded, err := homedir.Expand(vaultPath); err == nil {
+		vaultPath = expanded
+	}
+	return vaultPath
+}
+
+func VaultExists() bool {
+	_, err := os.Stat(VaultPath())
+	return err == nil
+}
+
+func deriveKey(password, salt []byte, n, r, p int) (key [32]byte, err error) {
+	derived, err := scrypt.Key(password, salt, n, r, p, len(key))
+	if err != nil {
+		return key, err
+	}
+	copy(key[:], derived)
+	return key, nil
+}
+
+// InitVault creates an empty vault encrypted by password, the existing vault is not overwritten
+func InitVault(password []byte) (*Vault, error) {
+	if VaultExists() {
+		return nil, fmt.Errorf("vault %s already exists", VaultPath())
+	}
+	if len(password) == 0 {
+		return nil, fmt.Errorf("vault password is required")
+	}
+
+	vault := &Vault{
+		Passwords:   map[string]string{},
+		Passphrases: map[string]string{},
+		path:        VaultPath(),
+		salt:        make([]byte, 16),
+		n:           scryptN,
+		r:           scryptR,
+		p:           scryptP,
+	}
+	if _, err := rand.Read(vault.salt); err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(password, vault.salt, vault.n, vault.r, vault.p)
+	if err != nil {
+		return nil, err
+	}
+	vault.key = key
+	return vault, vault.Save()
+}
+
+// OpenVault decrypts the vault with password
+func OpenVault(password []byte) (*Vault, error) {
+	data, err := os.ReadFile(VaultPath())
+	if os.IsNotExist(err) {
+		return nil, ErrVaultNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file vaultFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid vault %s: %v", VaultPath(), err)
+	}
+	if file.Version != vaultVersion || len(file.Nonce) != 24 {
+		return nil, fmt.Errorf("unsupported vault %s version %d", VaultPath(), file.Version)
+	}
+	key, err := deriveKey(password, file.Salt, file.N, file.R, file.P)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], file.Nonce)
+	plaintext, ok := secretbox.Open(nil, file.Data, &nonce, &key)
+	if !ok {
+		return nil, fmt.Errorf("wrong vault password")
+	}
+
+	vault := &Vault{path: VaultPath(), key: key, salt: file.Salt, n: file.N, r: file.R, p: file.P}
+	if err := json.Unmarshal(plaintext, vault); err != nil {
+		return nil, fmt.Errorf("invalid vault %s: %v", VaultPath(), err)
+	}
+	if vault.Passwords == nil {
+		vault.Passwords = map[string]string{}
+	}
+	if vault.Passphrases == nil {
+		vault.Passphrases = map[string]string{}
+	}
+	return vault, nil
+}
+
+// Save encrypts the vault with a new nonce and writes it atomically, the previous one is kept as "<path>.bak"
+func (v *Vault) Save() error {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(&vaultFile{
+		Version: vaultVersion,
+		N:       v.n,
+		R:       v.r,
+		P:       v.p,
+		Salt:    v.salt,
+		Nonce:   nonce[:],
+		Data:    secretbox.Seal(nil, plaintext, &nonce, &v.key),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(v.path, append(data, '\n'))
+}
+
+func (v *Vault) secrets(kind string) (map[string]string, error) {
+	switch kind {
+	case VaultPassword:
+		return v.Passwords, nil
+	case VaultPassphrase:
+		return v.Passphrases, nil
+	}
+	return nil, fmt.Errorf("invalid vault secret kind: %s", kind)
+}
+
+// vaultName normalizes the name, identity files are saved with absolute path
+func vaultName(kind, name string) string {
+	if kind != VaultPassphrase {
+		return name
+	}
+	if expanded, err := homedir.Expand(name); err == nil {
+		name = expanded
+	}
+	if absolute, err := filepath.Abs(name); err == nil {
+		name = absolute
+	}
+	return name
+}
+
+func (v *Vault) Set(kind, name, secret string) error {
+	secrets, err := v.secrets(kind)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("vault name is required")
+	}
+	secrets[vaultName(kind, name)] = secret
+	return nil
+}
+
+func (v *Vault) Get(kind, name string) (string, bool) {
+	secrets, err := v.secrets(kind)
+	if err != nil {
+		return "", false
+	}
+	secret, ok := secrets[vaultName(kind, name)]
+	return secret, ok
+}
+
+func (v *Vault) Remove(kind, name string) error {
+	secrets, err := v.secrets(kind)
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[vaultName(kind, name)]; !ok {
+		return fmt.Errorf("%s %s not found in vault", kind, name)
+	}
+	delete(secrets, vaultName(kind, name))
+	return nil
+}
+
+// Names returns the sorted names of kind
+func (v *Vault) Names(kind string) []string {
+	secrets, _ := v.secrets(kind)
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HostPassword returns the password of host, names are tried in order: "user@name", "name",
+// "user@hostname", "hostname", then the longest matched pattern
+func (v *Vault) HostPassword(host *Host) (string, bool) {
+	candidates := []string{host.Username + "@" + host.Name(), host.Name(), host.Username + "@" + host.HostName, host.HostName}
+	for _, name := range candidates {
+		if password, ok := v.Passwords[name]; ok {
+			return password, true
+		}
+	}
+
+	patterns := slices.SortedFunc(slices.Values(v.Names(VaultPassword)), func(a, b string) int {
+		return len(b) - len(a)
+	})
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			continue
+		}
+		username, hostPattern, hasUser := strings.Cut(pattern, "@")
+		if !hasUser {
+			hostPattern, username = username, ""
+		} else if username != host.Username {
+			continue
+		}
+		for _, name := range []string{host.Name(), host.HostName} {
+			if matched, _ := path.Match(hostPattern, name); matched {
+				return v.Passwords[pattern], true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,82 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/PWZER/dssh/config"
+	"github.com/PWZER/dssh/logger"
+)
+
+// ErrAskpass 是 SSH_ASKPASS 程序失败或取消的错误
+var ErrAskpass = errors.New("askpass failed")
+
+// 询问的类型，通过 DSSH_PROMPT_KIND 传给 passwordCommand
+const (
+	promptPassword            = "password"
+	promptPassphrase          = "passphrase"
+	promptKeyboardInteractive = "keyboard-interactive"
+)
+
+// askpassMode 与 ssh 一致: 默认在没有终端且有 DISPLAY 时使用 SSH_ASKPASS，
+// SSH_ASKPASS_REQUIRE 为 force 时总是使用，prefer 时有 DISPLAY 就使用，never 时不使用
+func askpassMode() (use, allow bool) {
+	if os.Getenv("SSH_ASKPASS") == "" {
+		return false, false
+	}
+	allow = os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+	switch strings.ToLower(os.Getenv("SSH_ASKPASS_REQUIRE")) {
+	case "force":
+		use, allow = true, true
+	case "prefer":
+		use = allow
+	case "never":
+		allow = false
+	}
+	return use, allow
+}
+
+// askpass 执行 SSH_ASKPASS 程序，问题作为参数，标准输出的第一行为回答
+func askpass(question string) (string, error) {
+	cmd := exec.Command(os.Getenv("SSH_ASKPASS"), question)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrAskpass, strings.TrimRight(question, ": "), err)
+	}
+	answer, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimRight(answer, "\r"), nil
+}
+
+// passwordCommand 执行 dssh 配置中匹配主机的 passwordCommand，标准输出的第一行为回答，
+// 没有配置或执行失败时返回 false，继续询问
+func passwordCommand(host *config.Host, kind, question string) (string, bool) {
+	command, err := config.PasswordCommand(host)
+	if err != nil {
+		logger.Warnf("%v", err)
+		return "", false
+	}
+	if command == "" {
+		return "", false
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"DSSH_PROMPT="+strings.TrimSpace(question),
+		"DSSH_PROMPT_KIND="+kind,
+		"DSSH_HOST="+host.Name(),
+		"DSSH_HOSTNAME="+host.HostName,
+		"DSSH_USER="+host.Username,
+	)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		logger.Warnf("password command of %s failed: %v", host.Name(), err)
+		return "", false
+	}
+	answer, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimRight(answer, "\r"), true
+}
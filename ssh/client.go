@@ -1,8 +1,17 @@
 package ssh
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
@@ -14,30 +23,175 @@ import (
 	"github.com/PWZER/dssh/utils"
 )
 
+const (
+	StatusOK          = "ok"
+	StatusFailed      = "failed"
+	StatusUnreachable = "unreachable"
+	StatusAuthFailed  = "auth-failed"
+	StatusSkipped     = "skipped"
+	StatusInterrupted = "interrupted"
+	StatusTimeout     = "timeout"
+)
+
+// 命令超时后发送 TERM 信号，等待该时长后仍未退出则关闭会话
+const timeoutGracePeriod = 5 * time.Second
+
+var ErrTimeout = errors.New("timeout")
+
+// ConnectError 连接主机失败，Status 区分网络不可达与认证失败
+type ConnectError struct {
+	Status string
+	Host   *config.Host
+	Err    error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("connect %s failed: %v", e.Host.Summary(), e.Err)
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
 type Client struct {
-	sshClient  *ssh.Client
-	sftpClient *sftp.Client
+	sshClient   *ssh.Client
+	sftpClient  *sftp.Client
+	jumpClients []*ssh.Client
+	host        *config.Host // 已连接的目标主机
+	listeners   []io.Closer  // 端口转发的监听
+
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+	Timeout time.Duration // 命令执行超时，0 表示不限制
 }
 
 func NewClient() *Client {
-	return &Client{}
+	return &Client{
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
 }
 
-func (c *Client) Connect(host *config.Host) (err error) {
-	clientConfig := CreateClientConfig(host)
-	if c.sshClient == nil {
-		c.sshClient, err = ssh.Dial("tcp", host.EndPoint(), clientConfig)
-		return err
+// Connect 连接主机，timeout 为建立连接及密钥交换的超时时间，不包括主机公钥确认及认证时的输入，0 表示不限制
+func (c *Client) Connect(ctx context.Context, host *config.Host, timeout time.Duration) (err error) {
+	connectCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		connectCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var keyExchanged atomic.Bool
+	connectErr := func(status string, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if connectCtx.Err() != nil && !keyExchanged.Load() {
+			err = fmt.Errorf("%w: connect not finished in %s", ErrTimeout, timeout)
+		}
+		return &ConnectError{Status: status, Host: host, Err: err}
 	}
-	dial, err := c.sshClient.Dial("tcp", host.EndPoint())
+
+	conn, err := c.dial(connectCtx, host.EndPoint())
 	if err != nil {
-		return err
+		return connectErr(StatusUnreachable, err)
 	}
-	conn, chans, reqs, err := ssh.NewClientConn(dial, host.EndPoint(), clientConfig)
+
+	// 握手过程中取消时关闭连接
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	// 密钥交换超时时关闭连接，收到主机公钥后停止计时
+	stopTimeout := context.AfterFunc(connectCtx, func() { conn.Close() })
+	defer stopTimeout()
+
+	clientConfig, err := CreateClientConfig(host)
 	if err != nil {
-		return err
+		conn.Close()
+		return &ConnectError{Status: StatusFailed, Host: host, Err: err}
+	}
+	hostKeyCallback := clientConfig.HostKeyCallback
+	clientConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if stopTimeout() {
+			keyExchanged.Store(true)
+		}
+		return hostKeyCallback(hostname, remote, key)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, host.EndPoint(), clientConfig)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil || (connectCtx.Err() != nil && !keyExchanged.Load()) {
+			return connectErr(StatusUnreachable, err)
+		}
+		if strings.Contains(err.Error(), "unable to authenticate") || errors.Is(err, ErrBatchMode) || errors.Is(err, ErrNoTerminal) || errors.Is(err, ErrAskpass) {
+			return &ConnectError{Status: StatusAuthFailed, Host: host, Err: err}
+		}
+		if errors.Is(err, ErrHostKey) {
+			return &ConnectError{Status: StatusFailed, Host: host, Err: err}
+		}
+		return &ConnectError{Status: StatusUnreachable, Host: host, Err: err}
+	}
+	if c.sshClient != nil {
+		c.jumpClients = append(c.jumpClients, c.sshClient)
+	}
+	c.sshClient = ssh.NewClient(sshConn, chans, reqs)
+	c.host = host
+	if host.ServerAliveInterval > 0 {
+		go keepAlive(c.sshClient, host)
+	}
+	return nil
+}
+
+// dial 建立到 address 的连接，已连接跳板机时通过跳板机转发
+func (c *Client) dial(ctx context.Context, address string) (net.Conn, error) {
+	if c.sshClient == nil {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+	return c.sshClient.DialContext(ctx, "tcp", address)
+}
+
+// keepAlive 每隔 ServerAliveInterval 发送心跳，连续 ServerAliveCountMax 次无响应时断开连接
+func keepAlive(client *ssh.Client, host *config.Host) {
+	ticker := time.NewTicker(host.ServerAliveInterval)
+	defer ticker.Stop()
+
+	missed := 0
+	for range ticker.C {
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+
+		select {
+		case err := <-reply:
+			if err != nil {
+				return // 连接已关闭
+			}
+			missed = 0
+		case <-time.After(host.ServerAliveInterval):
+			if missed++; missed >= host.ServerAliveCountMax {
+				logger.Warnf("%s no response after %d keepalive, disconnect", host.Summary(), missed)
+				client.Close()
+				return
+			}
+		}
+	}
+}
+
+// Close 关闭目标主机及所有跳板机的连接
+func (c *Client) Close() error {
+	var err error
+	for _, listener := range c.listeners {
+		listener.Close()
+	}
+	if c.sshClient != nil {
+		err = c.sshClient.Close()
+	}
+	for i := len(c.jumpClients) - 1; i >= 0; i-- {
+		c.jumpClients[i].Close()
 	}
-	c.sshClient = ssh.NewClient(conn, chans, reqs)
 	return err
 }
 
@@ -57,12 +211,34 @@ func (c *Client) MakeSession() (*ssh.Session, error) {
 	if err != nil {
 		return session, err
 	}
-	session.Stdin = os.Stdin
-	session.Stdout = os.Stdout
-	session.Stderr = os.Stderr
+	session.Stdin = c.Stdin
+	session.Stdout = c.Stdout
+	session.Stderr = c.Stderr
+	c.setEnv(session)
 	return session, nil
 }
 
+// setEnv 设置 SetEnv 及 SendEnv 匹配的本地环境变量，服务端拒绝时忽略
+func (c *Client) setEnv(session *ssh.Session) {
+	if c.host == nil {
+		return
+	}
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if slices.ContainsFunc(c.host.SendEnv, func(pattern string) bool {
+			matched, _ := path.Match(pattern, name)
+			return matched
+		}) {
+			session.Setenv(name, value)
+		}
+	}
+	for _, env := range c.host.SetEnv {
+		if name, value, ok := strings.Cut(env, "="); ok {
+			session.Setenv(name, value)
+		}
+	}
+}
+
 func (c *Client) Execute(cmd string) (int, error) {
 	exitCode := 0
 	session, err := c.MakeSession()
@@ -71,13 +247,42 @@ func (c *Client) Execute(cmd string) (int, error) {
 	}
 	defer session.Close()
 
+	// 执行命令时仅在 ForwardAgent yes 时转发
+	if c.host != nil && c.host.ForwardAgent == "yes" {
+		if err := c.RequestAgentForwarding(session); err != nil {
+			logger.Warnf("%s agent forwarding failed: %v", c.host.Summary(), err)
+		}
+	}
+
 	if err = session.Start(cmd); err != nil {
 		return exitCode, err
 	}
-	if err = session.Wait(); err != nil {
-		if werr, ok := err.(*ssh.ExitError); ok {
-			exitCode = werr.ExitStatus()
+
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+
+	var timeout <-chan time.Time
+	if c.Timeout > 0 {
+		timer := time.NewTimer(c.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case err = <-done:
+	case <-timeout:
+		// 先通知远程进程退出，未响应时直接关闭会话
+		session.Signal(ssh.SIGTERM)
+		select {
+		case <-done:
+		case <-time.After(timeoutGracePeriod):
+			session.Close()
 		}
+		return -1, fmt.Errorf("%w: command not finished in %s", ErrTimeout, c.Timeout)
+	}
+
+	if werr, ok := err.(*ssh.ExitError); ok {
+		exitCode = werr.ExitStatus()
 	}
 	return exitCode, err
 }
@@ -97,8 +302,15 @@ func (c *Client) Shell(remoteListen, proxyServer string) error {
 	}
 	defer session.Close()
 
-	// agent forward
-	if err := c.RequestAgentForwarding(session); err != nil {
+	// agent forward，交互式登录默认转发，ForwardAgent no 时不转发
+	if c.host == nil || c.host.ForwardAgent != "no" {
+		if err := c.RequestAgentForwarding(session); err != nil {
+			logger.Warnf("agent forwarding failed: %v", err)
+		}
+	}
+
+	// LocalForward、RemoteForward 及 DynamicForward
+	if err := c.StartForwards(); err != nil {
 		return err
 	}
 
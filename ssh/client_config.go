@@ -1,87 +1,187 @@
 package ssh
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"path"
+	"slices"
 	"strings"
-	"syscall"
+	"sync/atomic"
 
 	gossh "golang.org/x/crypto/ssh"
-	"golang.org/x/term"
 
 	"github.com/PWZER/dssh/config"
 	"github.com/PWZER/dssh/logger"
 )
 
-func getPassword(prompt string) (password string, err error) {
-	fmt.Printf(prompt)
-	bytePassword, err := term.ReadPassword(int(syscall.Stdin))
+// readPublicKey 读取私钥对应的 .pub 公钥文件，不存在时返回 nil
+func readPublicKey(identityFile string) gossh.PublicKey {
+	content, err := os.ReadFile(identityFile + ".pub")
 	if err != nil {
-		return password, err
+		return nil
 	}
-	password = strings.TrimSpace(string(bytePassword))
-	fmt.Println()
-	return password, err
+	publicKey, _, _, _, err := gossh.ParseAuthorizedKey(content)
+	if err != nil {
+		return nil
+	}
+	return publicKey
+}
+
+func containsPublicKey(signers []gossh.Signer, publicKey gossh.PublicKey) bool {
+	return slices.ContainsFunc(signers, func(signer gossh.Signer) bool {
+		return bytes.Equal(signer.PublicKey().Marshal(), publicKey.Marshal())
+	})
 }
 
-func doKeyboardInteractive(user, instruction string, questions []string, echos []bool) (answers []string, err error) {
-	for _, question := range questions {
-		fmt.Print(question)
-		var answer string
-		if _, err := fmt.Scan(&answer); err != nil {
-			return answers, err
+// certificateSigners 使用 CertificateFile 及 <IdentityFile>-cert.pub 中的证书包装对应的私钥
+func certificateSigners(host *config.Host, signers []gossh.Signer) (certSigners []gossh.Signer) {
+	certificateFiles := slices.Clone(host.CertificateFiles)
+	for _, identityFile := range host.IdentityFiles {
+		if _, err := os.Stat(identityFile + "-cert.pub"); err == nil {
+			certificateFiles = append(certificateFiles, identityFile+"-cert.pub")
+		}
+	}
+
+	for _, certificateFile := range certificateFiles {
+		content, err := os.ReadFile(certificateFile)
+		if err != nil {
+			logger.Warnf("read certificate file error: %v", err)
+			continue
+		}
+		publicKey, _, _, _, err := gossh.ParseAuthorizedKey(content)
+		if err != nil {
+			logger.Warnf("parse certificate file %s error: %v", certificateFile, err)
+			continue
+		}
+		cert, ok := publicKey.(*gossh.Certificate)
+		if !ok {
+			logger.Warnf("%s is not a certificate", certificateFile)
+			continue
+		}
+		for _, signer := range signers {
+			if !bytes.Equal(signer.PublicKey().Marshal(), cert.Key.Marshal()) {
+				continue
+			}
+			certSigner, err := gossh.NewCertSigner(cert, signer)
+			if err != nil {
+				logger.Warnf("use certificate file %s error: %v", certificateFile, err)
+				continue
+			}
+			certSigners = append(certSigners, certSigner)
+			logger.Debugf("use certificate file: %s", certificateFile)
 		}
-		answers = append(answers, answer)
 	}
-	return answers, nil
+	return certSigners
 }
 
 func getSignersCallback(host *config.Host) (signers []gossh.Signer, err error) {
+	// IdentitiesOnly 时只使用 ssh-agent 中与私钥文件对应的私钥
+	var identityKeys []gossh.PublicKey
+	for _, identityFile := range host.IdentityFiles {
+		if publicKey := readPublicKey(identityFile); publicKey != nil {
+			identityKeys = append(identityKeys, publicKey)
+		}
+	}
+
 	// 优先使用 ssh-agent 中已有的私钥
 	if a, err := NewAgent(); err != nil {
 		logger.Warnf("ssh-agent error: %v", err)
 	} else if agentSigners, err := a.Signers(); err != nil {
 		logger.Warnf("ssh-agent signers error: %v", err)
 	} else {
-		signers = append(signers, agentSigners...)
+		for _, signer := range agentSigners {
+			if host.IdentitiesOnly && !slices.ContainsFunc(identityKeys, func(key gossh.PublicKey) bool {
+				return bytes.Equal(key.Marshal(), signer.PublicKey().Marshal())
+			}) {
+				continue
+			}
+			signers = append(signers, signer)
+		}
 	}
 
 	// 使用私钥文件
+	var batchErr error
 	for _, identityFile := range host.IdentityFiles {
-		privateKeyBytes, err := os.ReadFile(identityFile)
-		if err != nil {
-			logger.Warnf("read private key file error: %v", err)
+		// ssh-agent 中已有该私钥时不再读取，避免重复输入私钥密码
+		if publicKey := readPublicKey(identityFile); publicKey != nil && containsPublicKey(signers, publicKey) {
 			continue
 		}
-		signer, err := gossh.ParsePrivateKey(privateKeyBytes)
+
+		signer, err := loadIdentity(host, identityFile)
 		if err != nil {
-			if _, ok := err.(*gossh.PassphraseMissingError); !ok {
-				logger.Warnf("parse private key file %s error: %v", identityFile, err)
-				continue
+			// 批处理模式下跳过需要输入密码的私钥，没有其他可用的私钥时才失败
+			if errors.Is(err, ErrBatchMode) {
+				batchErr = err
 			}
+			logger.Warnf("%v", err)
+			continue
+		}
+		signers = append(signers, signer)
+		logger.Debugf("use private key file: %s", identityFile)
+	}
+	if len(signers) == 0 && batchErr != nil {
+		return nil, batchErr
+	}
 
-			// 输入私钥密码
-			prompt := fmt.Sprintf("[%s] Enter Identity Passphrase (%s)", host.Summary(), identityFile)
-			password, err := getPassword(prompt)
-			if err != nil {
-				logger.Warnf("get password error: %v", err)
-				continue
+	// 证书优先于私钥
+	return append(certificateSigners(host, signers), signers...), nil
+}
+
+// matchAlgorithms 展开逗号分隔的算法列表，支持通配符，不支持的算法由 x/crypto/ssh 忽略
+func matchAlgorithms(patterns string, all []string) (algorithms []string) {
+	for _, pattern := range strings.Split(patterns, ",") {
+		if !strings.ContainsAny(pattern, "*?") {
+			algorithms = append(algorithms, pattern)
+			continue
+		}
+		for _, name := range all {
+			if ok, _ := path.Match(pattern, name); ok && !slices.Contains(algorithms, name) {
+				algorithms = append(algorithms, name)
 			}
+		}
+	}
+	return algorithms
+}
 
-			signer, err = gossh.ParsePrivateKeyWithPassphrase(privateKeyBytes, []byte(password))
-			if err != nil {
-				logger.Warnf("parse private key file %s with passphrase error: %v", identityFile, err)
-				continue
+// algorithmList 解析 ssh_config 的算法列表，"+" 追加、"-" 删除、"^" 前置于默认算法，为空时使用默认算法
+func algorithmList(value string, defaults, insecure []string) []string {
+	if value == "" {
+		return nil
+	}
+	all := slices.Concat(defaults, insecure)
+	switch value[0] {
+	case '+':
+		algorithms := slices.Clone(defaults)
+		for _, name := range matchAlgorithms(value[1:], all) {
+			if !slices.Contains(algorithms, name) {
+				algorithms = append(algorithms, name)
 			}
 		}
-		signers = append(signers, signer)
-		logger.Debugf("use private key file: %s", identityFile)
+		return algorithms
+	case '-':
+		removed := matchAlgorithms(value[1:], all)
+		return slices.DeleteFunc(slices.Clone(defaults), func(name string) bool {
+			return slices.Contains(removed, name)
+		})
+	case '^':
+		algorithms := matchAlgorithms(value[1:], all)
+		for _, name := range defaults {
+			if !slices.Contains(algorithms, name) {
+				algorithms = append(algorithms, name)
+			}
+		}
+		return algorithms
+	default:
+		return matchAlgorithms(value, all)
 	}
-	return signers, nil
 }
 
-func CreateClientConfig(host *config.Host) *gossh.ClientConfig {
+func CreateClientConfig(host *config.Host) (*gossh.ClientConfig, error) {
 	var auth []gossh.AuthMethod
+	// StrictHostKeyChecking 为 no 时公钥变化仍可连接，但不使用密码及 keyboard-interactive 认证
+	var keyChanged atomic.Bool
 
 	// 私钥
 	auth = append(auth, gossh.PublicKeysCallback(func() (signers []gossh.Signer, err error) {
@@ -89,23 +189,41 @@ func CreateClientConfig(host *config.Host) *gossh.ClientConfig {
 	}))
 
 	// 私钥无法登录时，使用输入密码的方式
-	auth = append(auth, gossh.PasswordCallback(func() (string, error) {
-		return getPassword(fmt.Sprintf("[%s] Enter Password: ", host.Summary()))
-	}))
+	auth = append(auth, passwordAuth(host, &keyChanged))
 
 	// 二次验证交互等
+	challenge := prompts.keyboardInteractive(host)
 	auth = append(auth, gossh.RetryableAuthMethod(
-		gossh.KeyboardInteractiveChallenge(doKeyboardInteractive),
+		gossh.KeyboardInteractiveChallenge(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			if keyChanged.Load() {
+				return nil, errHostKeyChanged(host)
+			}
+			return challenge(user, instruction, questions, echos)
+		}),
 		3,
 	))
 
-	return &gossh.ClientConfig{
+	hostKeyCallback, err := newHostKeyCallback(host, &keyChanged)
+	if err != nil {
+		return nil, err
+	}
+
+	supported, insecure := gossh.SupportedAlgorithms(), gossh.InsecureAlgorithms()
+	clientConfig := &gossh.ClientConfig{
 		User: host.Username,
 		Auth: auth,
 		BannerCallback: func(message string) error {
 			fmt.Println(message)
 			return nil
 		},
-		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: algorithmList(host.HostKeyAlgorithms, supported.HostKeys, insecure.HostKeys),
+	}
+	if host.HostKeyAlgorithms == "" {
+		clientConfig.HostKeyAlgorithms = knownHostKeyAlgorithms(host, supported.HostKeys)
 	}
+	clientConfig.Ciphers = algorithmList(host.Ciphers, supported.Ciphers, insecure.Ciphers)
+	clientConfig.KeyExchanges = algorithmList(host.KexAlgorithms, supported.KeyExchanges, insecure.KeyExchanges)
+	clientConfig.MACs = algorithmList(host.MACs, supported.MACs, insecure.MACs)
+	return clientConfig, nil
 }
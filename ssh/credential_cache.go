@@ -0,0 +1,176 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/PWZER/dssh/config"
+	"github.com/PWZER/dssh/logger"
+)
+
+// identity 是私钥文件解析后的缓存，mutex 保证同一私钥文件只询问一次密码
+type identity struct {
+	mutex  sync.Mutex
+	signer gossh.Signer
+	// tried 记录是否已使用过 passwordCommand 的输出，每个私钥只使用一次
+	tried bool
+}
+
+// identities 缓存私钥文件解析的结果，整个进程内有效，避免每个主机及跳板机重复输入私钥密码
+var identities sync.Map
+
+// loadIdentity 解析私钥文件，加密的私钥询问密码，解析失败时不缓存
+func loadIdentity(host *config.Host, identityFile string) (gossh.Signer, error) {
+	value, _ := identities.LoadOrStore(identityFile, &identity{})
+	cached := value.(*identity)
+	cached.mutex.Lock()
+	defer cached.mutex.Unlock()
+	if cached.signer != nil {
+		return cached.signer, nil
+	}
+
+	privateKeyBytes, err := os.ReadFile(identityFile)
+	if err != nil {
+		return nil, fmt.Errorf("read private key file error: %v", err)
+	}
+	signer, err := gossh.ParsePrivateKey(privateKeyBytes)
+	if err != nil {
+		if _, ok := err.(*gossh.PassphraseMissingError); !ok {
+			return nil, fmt.Errorf("parse private key file %s error: %v", identityFile, err)
+		}
+
+		// 优先使用 vault 中的私钥密码
+		if vault := openVault(host); vault != nil {
+			if passphrase, ok := vault.Get(config.VaultPassphrase, identityFile); ok {
+				if signer, err := gossh.ParsePrivateKeyWithPassphrase(privateKeyBytes, []byte(passphrase)); err == nil {
+					cached.signer = signer
+					return signer, nil
+				}
+				logger.Warnf("passphrase of %s in vault is wrong", identityFile)
+			}
+		}
+
+		// 其次使用一次 passwordCommand 的输出
+		question := fmt.Sprintf("Enter Identity Passphrase (%s): ", identityFile)
+		if !cached.tried {
+			cached.tried = true
+			if passphrase, ok := passwordCommand(host, promptPassphrase, question); ok {
+				if signer, err := gossh.ParsePrivateKeyWithPassphrase(privateKeyBytes, []byte(passphrase)); err == nil {
+					cached.signer = signer
+					return signer, nil
+				}
+				logger.Warnf("passphrase of %s from password command is wrong", identityFile)
+			}
+		}
+
+		// 最后输入私钥密码，批处理模式下直接失败
+		password, err := prompts.password(host, question)
+		if err != nil {
+			return nil, err
+		}
+		signer, err = gossh.ParsePrivateKeyWithPassphrase(privateKeyBytes, []byte(password))
+		if err != nil {
+			return nil, fmt.Errorf("parse private key file %s with passphrase error: %v", identityFile, err)
+		}
+	}
+	cached.signer = signer
+	return signer, nil
+}
+
+// passwords 缓存输入过的密码，按用户名及标签或跳板机分组
+var passwords sync.Map
+
+// passwordGroups 返回主机可共用密码的分组，同一主机作为跳板机时也共用
+func passwordGroups(host *config.Host) (groups []string) {
+	groups = append(groups, host.Summary())
+	for _, tag := range host.TagList {
+		groups = append(groups, fmt.Sprintf("%s\x00tag\x00%s", host.Username, tag))
+	}
+	if len(host.JumpList) > 0 {
+		groups = append(groups, fmt.Sprintf("%s\x00jump\x00%s", host.Username, host.JumpString()))
+	}
+	return groups
+}
+
+// knownPasswords 返回询问前先尝试的密码，依次为 vault 中的密码、passwordCommand 的输出及同组主机输入过的密码
+func knownPasswords(host *config.Host) (known []string) {
+	if vault := openVault(host); vault != nil {
+		if password, ok := vault.HostPassword(host); ok {
+			known = append(known, password)
+		}
+	}
+	if password, ok := passwordCommand(host, promptPassword, "Enter Password: "); ok && !slices.Contains(known, password) {
+		known = append(known, password)
+	}
+	if host.ReusePassword {
+		for _, group := range passwordGroups(host) {
+			if password, ok := passwords.Load(group); ok && !slices.Contains(known, password.(string)) {
+				known = append(known, password.(string))
+				break
+			}
+		}
+	}
+	return known
+}
+
+// passwordAuth 返回密码登录方式，先尝试已知的密码，都失败后再询问
+func passwordAuth(host *config.Host, keyChanged *atomic.Bool) gossh.AuthMethod {
+	var known []string
+	attempts := 0
+	return gossh.RetryableAuthMethod(gossh.PasswordCallback(func() (string, error) {
+		if keyChanged.Load() {
+			return "", errHostKeyChanged(host)
+		}
+		if attempts == 0 {
+			known = knownPasswords(host)
+		}
+		if attempts++; attempts <= len(known) {
+			return known[attempts-1], nil
+		}
+
+		password, err := prompts.password(host, "Enter Password: ")
+		if err != nil {
+			return "", err
+		}
+		if host.ReusePassword {
+			for _, group := range passwordGroups(host) {
+				passwords.Store(group, password)
+			}
+		}
+		return password, nil
+	}), 4)
+}
+
+var (
+	vaultOnce sync.Once
+	vault     *config.Vault
+)
+
+// openVault 第一次需要密码时解锁 vault，整个进程只解锁一次，vault 不存在或解锁失败时返回 nil
+func openVault(host *config.Host) *config.Vault {
+	vaultOnce.Do(func() {
+		if !config.VaultExists() {
+			return
+		}
+		password := os.Getenv(config.VaultPasswordEnv)
+		if password == "" {
+			var err error
+			if password, err = prompts.password(host, "Enter Vault Password: "); err != nil {
+				logger.Warnf("unlock vault failed: %v", err)
+				return
+			}
+		}
+		opened, err := config.OpenVault([]byte(password))
+		if err != nil {
+			logger.Warnf("unlock vault failed: %v", err)
+			return
+		}
+		vault = opened
+	})
+	return vault
+}
@@ -0,0 +1,265 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+
+	"github.com/PWZER/dssh/config"
+)
+
+var (
+	ErrInterrupted = errors.New("interrupted")
+	ErrAborted     = errors.New("aborted by user")
+)
+
+type taskResult struct {
+	Task     *config.Task
+	ExitCode int
+	Err      error
+	Output   []byte
+	Duration time.Duration
+}
+
+// Finished 远程命令已执行结束，包括退出码非 0 的情况
+func (r *taskResult) Finished() bool {
+	if r.Err == nil {
+		return true
+	}
+	_, ok := r.Err.(*gossh.ExitError)
+	return ok
+}
+
+type executor struct {
+	tc        *config.TaskConfig
+	total     int
+	parallel  int
+	nameWidth int
+	batches   [][]*config.Task
+	maxFail   int
+	results   []*taskResult
+
+	mutex   sync.Mutex // 保护终端输出及 err、failed
+	err     error
+	failed  int
+	stopped atomic.Bool
+}
+
+func isInteractiveTask(task *config.Task) bool {
+	return task.Command == "" && task.DownloadSrc == "" && task.UploadSrc == ""
+}
+
+func newExecutor(tc *config.TaskConfig) (e *executor, err error) {
+	e = &executor{tc: tc, total: len(tc.Tasks), parallel: tc.Parallel}
+	e.results = make([]*taskResult, e.total)
+	if e.batches, err = tc.Batches(); err != nil {
+		return nil, err
+	}
+	if e.maxFail, err = tc.MaxFailCount(); err != nil {
+		return nil, err
+	}
+	if e.parallel < 1 {
+		e.parallel = 1
+	}
+	if e.parallel > e.total {
+		e.parallel = e.total
+	}
+
+	for _, task := range tc.Tasks {
+		// 交互式终端只能逐个执行
+		if isInteractiveTask(task) {
+			e.parallel = 1
+		}
+		e.nameWidth = max(e.nameWidth, len(task.Target.Name()))
+	}
+	return e, nil
+}
+
+// 需在加锁时调用，非终端时仅在 always 为 true 时输出
+func (e *executor) printBanner(task *config.Task, always bool) {
+	message := fmt.Sprintf("-----> [%d / %d] %s %s <-----",
+		task.Index+1, e.total, task.Target.Summary(), task.Message)
+	termWidth, _, err := term.GetSize(int(os.Stdin.Fd()))
+	if err != nil || termWidth <= 0 {
+		if always {
+			fmt.Fprintln(os.Stderr, message)
+		}
+		return
+	}
+	fillLen := termWidth - int(math.Mod(float64(len(message)), float64(termWidth)))
+	if fillLen > 0 {
+		message = fmt.Sprintf("\033[1;32m%s%s\033[0m", message, strings.Repeat("-", fillLen))
+	}
+	fmt.Fprintln(os.Stderr, message)
+}
+
+func (e *executor) printBuffered(task *config.Task, output *taskOutput) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.printBanner(task, true)
+	os.Stdout.Write(output.stdoutBuffer.Bytes())
+	os.Stderr.Write(output.stderrBuffer.Bytes())
+}
+
+func (e *executor) runTask(ctx context.Context, task *config.Task) {
+	result := e.doTask(ctx, task)
+	// 中断时未完成的任务记为中断，中断前已失败的任务保留失败原因
+	if ctx.Err() != nil && !result.Finished() {
+		result.Err = ErrInterrupted
+	}
+	e.results[task.Index] = result
+
+	err := result.Err
+	if err == nil {
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// 中断时不再逐个报告错误
+	if ctx.Err() != nil {
+		return
+	}
+
+	e.failed++
+	if e.tc.FailedContinue {
+		fmt.Printf("[ERROR] [%s] %s\n", task.Target.Summary(), err)
+		if e.maxFail == 0 || e.failed < e.maxFail {
+			return
+		}
+		err = fmt.Errorf("%d hosts failed, reached max fail %s", e.failed, e.tc.MaxFail)
+	}
+	if e.err == nil {
+		e.err = err
+	}
+	// 出错后不再调度新的任务，已在执行的任务继续完成
+	e.stopped.Store(true)
+}
+
+func (e *executor) doTask(ctx context.Context, task *config.Task) *taskResult {
+	result := &taskResult{Task: task, ExitCode: -1}
+	startTime := time.Now()
+	defer func() { result.Duration = time.Since(startTime) }()
+
+	output, err := e.newTaskOutput(task)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	client := NewClient()
+	client.Stdout, client.Stderr = output.Stdout, output.Stderr
+	if e.parallel > 1 || e.tc.BatchConfirm {
+		// 并发执行时不能共享标准输入，分批确认时标准输入用于读取确认
+		client.Stdin = nil
+	}
+
+	if !output.Buffered() && !output.Grouped() {
+		e.mutex.Lock()
+		e.printBanner(task, false)
+		e.mutex.Unlock()
+	}
+	result.ExitCode, result.Err = taskStart(ctx, task, client)
+	output.Close()
+	if output.Buffered() {
+		e.printBuffered(task, output)
+	}
+	if output.Grouped() {
+		result.Output = output.Combined()
+	}
+	return result
+}
+
+func (e *executor) runBatch(ctx context.Context, tasks []*config.Task) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, e.parallel)
+	for _, task := range tasks {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil || e.stopped.Load() {
+			break
+		}
+
+		wg.Add(1)
+		go func(task *config.Task) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			e.runTask(ctx, task)
+		}(task)
+	}
+	wg.Wait()
+}
+
+// 分批执行时，在下一批开始前暂停或等待用户确认
+func (e *executor) waitNextBatch(ctx context.Context, index int) error {
+	if e.tc.BatchPause > 0 {
+		fmt.Fprintf(os.Stderr, "pause %s before batch [%d / %d]\n", e.tc.BatchPause, index+1, len(e.batches))
+		select {
+		case <-time.After(e.tc.BatchPause):
+		case <-ctx.Done():
+			return ErrInterrupted
+		}
+	}
+
+	if e.tc.BatchConfirm {
+		question := fmt.Sprintf("continue with batch [%d / %d] (%d hosts)? [y/N] ",
+			index+1, len(e.batches), len(e.batches[index]))
+		answers := make(chan string, 1)
+		go func() {
+			answer, _ := prompts.readLine(question)
+			answers <- answer
+		}()
+
+		var answer string
+		select {
+		case answer = <-answers:
+		case <-ctx.Done():
+			return ErrInterrupted
+		}
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			return ErrAborted
+		}
+	}
+	return nil
+}
+
+func (e *executor) run(ctx context.Context) error {
+	for i, batch := range e.batches {
+		if i > 0 {
+			if err := e.waitNextBatch(ctx, i); err != nil {
+				if e.err == nil && ctx.Err() == nil {
+					e.err = err
+				}
+				break
+			}
+		}
+
+		if len(e.batches) > 1 {
+			fmt.Fprintf(os.Stderr, "=====> batch [%d / %d] %d hosts <=====\n", i+1, len(e.batches), len(batch))
+		}
+		e.runBatch(ctx, batch)
+		if ctx.Err() != nil || e.stopped.Load() {
+			break
+		}
+	}
+
+	if e.tc.Output == config.OutputGroup {
+		printGroups(e.results)
+	}
+	if ctx.Err() != nil {
+		return ErrInterrupted
+	}
+	return e.err
+}
@@ -0,0 +1,205 @@
+package ssh
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/PWZER/dssh/logger"
+)
+
+// parseForwardAddress 解析 "[bind_address:]port"，未指定时绑定 localhost
+func parseForwardAddress(value string) (string, error) {
+	if _, err := strconv.ParseUint(value, 10, 16); err == nil {
+		return net.JoinHostPort("localhost", value), nil
+	}
+	index := strings.LastIndex(value, ":")
+	if index < 0 {
+		return "", fmt.Errorf("invalid forward address: %s", value)
+	}
+	host, port := strings.Trim(value[:index], "[]"), value[index+1:]
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("invalid forward port: %s", value)
+	}
+	if host == "" || host == "*" {
+		host = "0.0.0.0"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// parseForward 解析 LocalForward、RemoteForward 的 "[bind_address:]port host:hostport"
+func parseForward(value string) (string, string, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("invalid forward: %s", value)
+	}
+	bind, err := parseForwardAddress(fields[0])
+	if err != nil {
+		return "", "", err
+	}
+	index := strings.LastIndex(fields[1], ":")
+	if index < 0 {
+		return "", "", fmt.Errorf("invalid forward target: %s", value)
+	}
+	target := net.JoinHostPort(strings.Trim(fields[1][:index], "[]"), fields[1][index+1:])
+	return bind, target, nil
+}
+
+// pipe 双向拷贝数据，任一方向结束后关闭两端
+func pipe(a, b net.Conn) {
+	defer a.Close()
+	defer b.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// serve 接收连接并转发到 dial 返回的连接，监听关闭后退出
+func serve(listener net.Listener, dial func(conn net.Conn) (net.Conn, error)) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			remote, err := dial(conn)
+			if err != nil {
+				logger.Warnf("forward %s failed: %v", listener.Addr(), err)
+				conn.Close()
+				return
+			}
+			pipe(conn, remote)
+		}()
+	}
+}
+
+// StartForwards 按 ssh config 启动 LocalForward、RemoteForward 及 DynamicForward
+func (c *Client) StartForwards() error {
+	if c.host == nil {
+		return nil
+	}
+
+	for _, forward := range c.host.LocalForwards {
+		bind, target, err := parseForward(forward)
+		if err != nil {
+			return err
+		}
+		listener, err := net.Listen("tcp", bind)
+		if err != nil {
+			return fmt.Errorf("local forward %s failed: %v", forward, err)
+		}
+		c.listeners = append(c.listeners, listener)
+		go serve(listener, func(net.Conn) (net.Conn, error) {
+			return c.sshClient.Dial("tcp", target)
+		})
+	}
+
+	for _, forward := range c.host.RemoteForwards {
+		bind, target, err := parseForward(forward)
+		if err != nil {
+			return err
+		}
+		listener, err := c.sshClient.Listen("tcp", bind)
+		if err != nil {
+			return fmt.Errorf("remote forward %s failed: %v", forward, err)
+		}
+		c.listeners = append(c.listeners, listener)
+		go serve(listener, func(net.Conn) (net.Conn, error) {
+			return net.Dial("tcp", target)
+		})
+	}
+
+	for _, forward := range c.host.DynamicForwards {
+		bind, err := parseForwardAddress(strings.TrimSpace(forward))
+		if err != nil {
+			return err
+		}
+		listener, err := net.Listen("tcp", bind)
+		if err != nil {
+			return fmt.Errorf("dynamic forward %s failed: %v", forward, err)
+		}
+		c.listeners = append(c.listeners, listener)
+		go serve(listener, c.socks5Connect)
+	}
+	return nil
+}
+
+// socks5Connect 处理 SOCKS5 握手，仅支持无认证的 CONNECT 命令
+func (c *Client) socks5Connect(conn net.Conn) (net.Conn, error) {
+	buf := make([]byte, 256)
+
+	// 版本及认证方法
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return nil, err
+	}
+	if buf[0] != 5 {
+		return nil, fmt.Errorf("unsupported socks version %d", buf[0])
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{5, 0}); err != nil {
+		return nil, err
+	}
+
+	// 请求: VER CMD RSV ATYP DST.ADDR DST.PORT
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return nil, err
+	}
+	if buf[1] != 1 {
+		conn.Write([]byte{5, 7, 0, 1, 0, 0, 0, 0, 0, 0})
+		return nil, fmt.Errorf("unsupported socks command %d", buf[1])
+	}
+
+	var host string
+	switch buf[3] {
+	case 1:
+		if _, err := io.ReadFull(conn, buf[:net.IPv4len]); err != nil {
+			return nil, err
+		}
+		host = net.IP(buf[:net.IPv4len]).String()
+	case 3:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return nil, err
+		}
+		length := int(buf[0])
+		if _, err := io.ReadFull(conn, buf[:length]); err != nil {
+			return nil, err
+		}
+		host = string(buf[:length])
+	case 4:
+		if _, err := io.ReadFull(conn, buf[:net.IPv6len]); err != nil {
+			return nil, err
+		}
+		host = net.IP(buf[:net.IPv6len]).String()
+	default:
+		conn.Write([]byte{5, 8, 0, 1, 0, 0, 0, 0, 0, 0})
+		return nil, fmt.Errorf("unsupported socks address type %d", buf[3])
+	}
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return nil, err
+	}
+	port := binary.BigEndian.Uint16(buf[:2])
+
+	remote, err := c.sshClient.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		remote.Close()
+		return nil, err
+	}
+	return remote, nil
+}
@@ -0,0 +1,191 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/PWZER/dssh/config"
+)
+
+const defaultKeyscanTimeout = 10 * time.Second
+
+// 每种公钥类型扫描一次，RSA 公钥可用多个签名算法
+var keyscanAlgorithms = [][]string{
+	{gossh.KeyAlgoED25519},
+	{gossh.KeyAlgoECDSA256},
+	{gossh.KeyAlgoECDSA384},
+	{gossh.KeyAlgoECDSA521},
+	{gossh.KeyAlgoRSASHA512, gossh.KeyAlgoRSASHA256, gossh.KeyAlgoRSA},
+	{gossh.KeyAlgoSKED25519},
+	{gossh.KeyAlgoSKECDSA256},
+	{gossh.InsecureKeyAlgoDSA},
+}
+
+// KeyscanOptions 是 keyscan 的选项
+type KeyscanOptions struct {
+	Write bool // 合并到 known_hosts，否则输出到标准输出
+	Hash  bool // 主机名使用 "|1|salt|hash" 格式
+}
+
+type keyscanResult struct {
+	host *config.Host
+	keys []gossh.PublicKey
+	err  error
+}
+
+// scanHost 通过跳板机连接主机，获取主机提供的所有类型的公钥
+func scanHost(ctx context.Context, task *config.Task) (keys []gossh.PublicKey, err error) {
+	if err := task.Target.JumpError(); err != nil {
+		return nil, err
+	}
+
+	client := NewClient()
+	defer client.Close()
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	defer stop()
+
+	timeout := func(host *config.Host) time.Duration {
+		if task.ConnectTimeout > 0 {
+			return task.ConnectTimeout
+		}
+		if host.ConnectTimeout > 0 {
+			return host.ConnectTimeout
+		}
+		return defaultKeyscanTimeout
+	}
+	for _, jump := range task.Target.JumpList {
+		if err := client.ConnectWithRetry(ctx, jump, timeout(jump), task.Retry); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, algorithms := range keyscanAlgorithms {
+		key, err := client.FetchHostKey(ctx, task.Target, algorithms, timeout(task.Target))
+		if errors.Is(err, ErrNoHostKeyAlgorithm) {
+			continue // 主机不提供该类型的公钥
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, &ConnectError{Status: StatusFailed, Host: task.Target, Err: fmt.Errorf("no host key offered")}
+	}
+	return keys, nil
+}
+
+// compareKnownHosts 对比 known_hosts 中同类型的公钥，返回新的公钥及公钥变化的说明
+func compareKnownHosts(host *config.Host, keys []gossh.PublicKey) (added []gossh.PublicKey, changed []string, err error) {
+	knownHosts, err := LookupKnownHosts(host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, key := range keys {
+		known, offending := false, []*KnownHost{}
+		for _, knownHost := range knownHosts {
+			if knownHost.Marker != "" || knownHost.Key.Type() != key.Type() {
+				continue
+			}
+			if bytes.Equal(knownHost.Key.Marshal(), key.Marshal()) {
+				known = true
+				break
+			}
+			offending = append(offending, knownHost)
+		}
+		switch {
+		case known:
+		case len(offending) > 0:
+			changed = append(changed, fmt.Sprintf("%s %s key changed to %s, was %s in %s:%d", knownHostsAddress(host),
+				key.Type(), Fingerprint(key), offending[0].Fingerprint(), offending[0].File, offending[0].Line))
+		default:
+			added = append(added, key)
+		}
+	}
+	return added, changed, nil
+}
+
+// Keyscan 并发扫描所有任务主机的公钥，输出 known_hosts 格式或合并到 known_hosts，公钥变化时标记
+func Keyscan(tc *config.TaskConfig, options *KeyscanOptions) error {
+	if len(tc.Tasks) == 0 {
+		return fmt.Errorf("one of \"<host>\" or \"--tags\" or \"--labels\" is required!")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	results := make([]*keyscanResult, len(tc.Tasks))
+	semaphore := make(chan struct{}, max(tc.Parallel, 1))
+	var wg sync.WaitGroup
+	for i, task := range tc.Tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			result := &keyscanResult{host: task.Target}
+			result.keys, result.err = scanHost(ctx, task)
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ErrInterrupted
+	}
+
+	failed, changed, added := 0, 0, 0
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+			fmt.Printf("# [ERROR] %s: %v\n", result.host.Name(), result.err)
+			continue
+		}
+		newKeys, changes, err := compareKnownHosts(result.host, result.keys)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			changed++
+			fmt.Printf("# [CHANGED] %s: %s\n", result.host.Name(), change)
+		}
+
+		if !options.Write {
+			for _, key := range result.keys {
+				fmt.Println(knownHostsLine(result.host, key, options.Hash))
+			}
+			continue
+		}
+
+		// 变化的公钥不覆盖，需确认后用 ds known-hosts pin 替换
+		lines := make([]string, 0, len(newKeys))
+		for _, key := range newKeys {
+			lines = append(lines, knownHostsLine(result.host, key, options.Hash))
+		}
+		if len(lines) > 0 {
+			if err := appendKnownHostLines(result.host, lines...); err != nil {
+				return err
+			}
+			added += len(lines)
+			fmt.Printf("# %s: %d keys added to %s\n", result.host.Name(), len(lines), result.host.UserKnownHostsFiles[0])
+		}
+	}
+
+	if options.Write {
+		fmt.Printf("# %d hosts scanned, %d keys added, %d keys changed, %d hosts failed\n", len(results), added, changed, failed)
+	}
+	if failed > 0 || changed > 0 {
+		return fmt.Errorf("%d keys changed, %d hosts failed", changed, failed)
+	}
+	return nil
+}
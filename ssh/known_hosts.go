@@ -0,0 +1,437 @@
+package ssh
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/PWZER/dssh/config"
+	"github.com/PWZER/dssh/logger"
+	"github.com/PWZER/dssh/utils"
+)
+
+// ErrHostKey 主机公钥校验失败，不重试
+var ErrHostKey = errors.New("host key verification failed")
+
+// KnownHost 是 known_hosts 文件中的一行
+type KnownHost struct {
+	File    string
+	Line    int
+	Marker  string // cert-authority, revoked 或为空
+	Hosts   []string
+	Key     gossh.PublicKey
+	Comment string
+}
+
+// matchWildcard 匹配 known_hosts 的 "*" 及 "?" 通配符
+func matchWildcard(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(name); i >= 0; i-- {
+				if matchWildcard(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(name) == 0 {
+				return false
+			}
+		default:
+			if len(name) == 0 || pattern[0] != name[0] {
+				return false
+			}
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matchHashed 匹配 "|1|salt|hash" 格式的主机名
+func matchHashed(hashed, address string) bool {
+	parts := strings.Split(hashed, "|")
+	if len(parts) != 4 || parts[1] != "1" {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(address))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+// Match 判断 address 是否匹配该行，address 为 knownhosts.Normalize 的格式
+func (k *KnownHost) Match(address string) (matched bool) {
+	for _, pattern := range k.Hosts {
+		if strings.HasPrefix(pattern, "|") {
+			matched = matched || matchHashed(pattern, address)
+			continue
+		}
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if matchWildcard(negated, address) {
+				return false
+			}
+			continue
+		}
+		matched = matched || matchWildcard(pattern, address)
+	}
+	return matched
+}
+
+// Fingerprint 返回公钥的 SHA256 指纹
+func Fingerprint(key gossh.PublicKey) string {
+	return gossh.FingerprintSHA256(key)
+}
+
+func (k *KnownHost) Fingerprint() string {
+	return Fingerprint(k.Key)
+}
+
+// ReadKnownHosts 读取 known_hosts 文件，不存在的文件忽略
+func ReadKnownHosts(files []string) (knownHosts []*KnownHost, err error) {
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			marker, hosts, key, comment, _, err := gossh.ParseKnownHosts([]byte(line))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", file, i+1, err)
+			}
+			knownHosts = append(knownHosts, &KnownHost{
+				File:    file,
+				Line:    i + 1,
+				Marker:  marker,
+				Hosts:   hosts,
+				Key:     key,
+				Comment: comment,
+			})
+		}
+	}
+	return knownHosts, nil
+}
+
+// knownHostsAddress 返回主机在 known_hosts 中的地址，如 "[127.0.0.1]:2201"
+func knownHostsAddress(host *config.Host) string {
+	return knownhosts.Normalize(host.EndPoint())
+}
+
+// LookupKnownHosts 返回匹配主机的 known_hosts 行
+func LookupKnownHosts(host *config.Host) ([]*KnownHost, error) {
+	knownHosts, err := ReadKnownHosts(host.UserKnownHostsFiles)
+	if err != nil {
+		return nil, err
+	}
+	address := knownHostsAddress(host)
+	return slices.DeleteFunc(knownHosts, func(k *KnownHost) bool {
+		return !k.Match(address)
+	}), nil
+}
+
+// RemoveKnownHost 删除主机的公钥，@cert-authority 及 @revoked 行保留，返回删除的行数
+func RemoveKnownHost(host *config.Host) (removed int, err error) {
+	address := knownHostsAddress(host)
+	for _, file := range host.UserKnownHostsFiles {
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+
+		lines := strings.SplitAfter(string(data), "\n")
+		kept := make([]string, 0, len(lines))
+		for _, line := range lines {
+			marker, hosts, key, _, _, err := gossh.ParseKnownHosts([]byte(line))
+			if err == nil && marker == "" && (&KnownHost{Hosts: hosts, Key: key}).Match(address) {
+				removed++
+				continue
+			}
+			kept = append(kept, line)
+		}
+		if len(kept) == len(lines) {
+			continue
+		}
+		if err := utils.WriteFileAtomic(file, []byte(strings.Join(kept, ""))); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// knownHostsLine 返回 known_hosts 格式的行，hash 时主机名使用 "|1|salt|hash" 格式
+func knownHostsLine(host *config.Host, key gossh.PublicKey, hash bool) string {
+	if !hash {
+		return knownhosts.Line([]string{host.EndPoint()}, key)
+	}
+	return knownhosts.HashHostname(knownHostsAddress(host)) + " " + strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key)))
+}
+
+// appendKnownHost 将主机公钥追加到第一个 known_hosts 文件
+func appendKnownHost(host *config.Host, key gossh.PublicKey) error {
+	return appendKnownHostLines(host, knownHostsLine(host, key, false))
+}
+
+func appendKnownHostLines(host *config.Host, lines ...string) error {
+	if len(host.UserKnownHostsFiles) == 0 {
+		return fmt.Errorf("no UserKnownHostsFile of %s", host.Summary())
+	}
+	file := host.UserKnownHostsFiles[0]
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(f, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// confirmHostKey 在终端上确认未知主机的公钥，批处理模式或非终端时拒绝
+func confirmHostKey(host *config.Host, key gossh.PublicKey) bool {
+	return prompts.confirm(host, fmt.Sprintf("The authenticity of host '%s' can't be established.\n"+
+		"%s key fingerprint is %s.\nAre you sure you want to continue connecting",
+		knownHostsAddress(host), key.Type(), Fingerprint(key)))
+}
+
+// newHostKeyCallback 按 StrictHostKeyChecking 校验主机公钥，默认为 ask
+//   - yes: 只接受 known_hosts 中的公钥
+//   - accept-new: 未知主机的公钥自动添加
+//   - ask: 在终端上确认未知主机的公钥
+//   - no: 未知主机的公钥自动添加，公钥变化时仅警告，keyChanged 置为 true，不再使用密码等认证方式
+func newHostKeyCallback(host *config.Host, keyChanged *atomic.Bool) (gossh.HostKeyCallback, error) {
+	files := make([]string, 0, len(host.UserKnownHostsFiles))
+	for _, file := range host.UserKnownHostsFiles {
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+	callback, err := knownhosts.New(files...)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := host.StrictHostKeyChecking
+	if mode == "" {
+		mode = "ask"
+	}
+	return func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var revokedErr *knownhosts.RevokedError
+		if errors.As(err, &revokedErr) {
+			return fmt.Errorf("%w: %s key %s of %s is revoked in %s:%d", ErrHostKey,
+				key.Type(), gossh.FingerprintSHA256(key), knownHostsAddress(host), revokedErr.Revoked.Filename, revokedErr.Revoked.Line)
+		}
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return fmt.Errorf("%w: %v", ErrHostKey, err)
+		}
+
+		// 公钥变化
+		if len(keyErr.Want) > 0 {
+			want := keyErr.Want[0]
+			if mode == "no" {
+				logger.Warnf("host key of %s changed, offending key in %s:%d, password and keyboard-interactive "+
+					"authentication are disabled", knownHostsAddress(host), want.Filename, want.Line)
+				keyChanged.Store(true)
+				return nil
+			}
+			return fmt.Errorf("%w: host key of %s changed to %s %s, it may be a man-in-the-middle attack, "+
+				"offending key in %s:%d, re-pin it with \"ds known-hosts pin %s\"", ErrHostKey, knownHostsAddress(host),
+				key.Type(), gossh.FingerprintSHA256(key), want.Filename, want.Line, host.Name())
+		}
+
+		// 未知主机
+		switch mode {
+		case "accept-new", "no":
+		case "ask":
+			if host.BatchMode {
+				return fmt.Errorf("%w: %w, host key of %s is unknown", ErrHostKey, ErrBatchMode, knownHostsAddress(host))
+			}
+			if !confirmHostKey(host, key) {
+				return fmt.Errorf("%w: host key of %s is unknown and not confirmed", ErrHostKey, knownHostsAddress(host))
+			}
+		default:
+			return fmt.Errorf("%w: host key of %s is unknown and StrictHostKeyChecking is %s", ErrHostKey, knownHostsAddress(host), mode)
+		}
+		if err := appendKnownHost(host, key); err != nil {
+			return err
+		}
+		logger.Warnf("permanently added %s (%s) to %s", knownHostsAddress(host), key.Type(), host.UserKnownHostsFiles[0])
+		return nil
+	}, nil
+}
+
+// errHostKeyChanged 是公钥变化时拒绝密码及 keyboard-interactive 认证的错误，与 ssh 一致，避免将密码泄露给中间人
+func errHostKeyChanged(host *config.Host) error {
+	return fmt.Errorf("%w: host key of %s changed, password and keyboard-interactive authentication are disabled "+
+		"to avoid man-in-the-middle attacks", ErrHostKey, knownHostsAddress(host))
+}
+
+// hostKeyAlgorithms 返回公钥类型可用的算法
+func hostKeyAlgorithms(keyType string) []string {
+	switch keyType {
+	case gossh.KeyAlgoRSA:
+		return []string{gossh.KeyAlgoRSASHA512, gossh.KeyAlgoRSASHA256, gossh.KeyAlgoRSA}
+	case gossh.CertAlgoRSAv01:
+		return []string{gossh.CertAlgoRSASHA512v01, gossh.CertAlgoRSASHA256v01, gossh.CertAlgoRSAv01}
+	}
+	return []string{keyType}
+}
+
+// knownHostKeyAlgorithms 将 known_hosts 中已有公钥的算法排在前面，避免服务端提供其他类型的公钥被误认为公钥变化；
+// 没有匹配的 @cert-authority 时证书算法排在最后
+func knownHostKeyAlgorithms(host *config.Host, defaults []string) []string {
+	knownHosts, err := LookupKnownHosts(host)
+	if err != nil {
+		return defaults
+	}
+
+	preferred := make([]string, 0)
+	hasAuthority := false
+	for _, knownHost := range knownHosts {
+		switch knownHost.Marker {
+		case "":
+			preferred = append(preferred, hostKeyAlgorithms(knownHost.Key.Type())...)
+		case "cert-authority":
+			hasAuthority = true
+		}
+	}
+
+	isCert := func(algorithm string) bool { return strings.Contains(algorithm, "-cert-") }
+	algorithms := make([]string, 0, len(defaults))
+	if hasAuthority {
+		algorithms = append(algorithms, slices.DeleteFunc(slices.Clone(defaults), func(algorithm string) bool {
+			return !isCert(algorithm)
+		})...)
+	}
+	for _, algorithm := range defaults {
+		if slices.Contains(preferred, algorithm) && !slices.Contains(algorithms, algorithm) {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	for _, algorithm := range defaults {
+		if !isCert(algorithm) && !slices.Contains(algorithms, algorithm) {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	for _, algorithm := range defaults {
+		if !slices.Contains(algorithms, algorithm) {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	return algorithms
+}
+
+var (
+	errHostKeyFetched = errors.New("host key fetched")
+	// ErrNoHostKeyAlgorithm 主机不提供指定算法的公钥
+	ErrNoHostKeyAlgorithm = errors.New("no common host key algorithm")
+)
+
+// FetchHostKey 连接主机获取指定算法的公钥，不登录
+func (c *Client) FetchHostKey(ctx context.Context, host *config.Host, algorithms []string, timeout time.Duration) (gossh.PublicKey, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	conn, err := c.dial(ctx, host.EndPoint())
+	if err != nil {
+		return nil, &ConnectError{Status: StatusUnreachable, Host: host, Err: err}
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var hostKey gossh.PublicKey
+	_, _, _, err = gossh.NewClientConn(conn, host.EndPoint(), &gossh.ClientConfig{
+		User:              host.Username,
+		HostKeyAlgorithms: algorithms,
+		HostKeyCallback: func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+			hostKey = key
+			return errHostKeyFetched
+		},
+	})
+	if hostKey == nil {
+		if ctx.Err() != nil {
+			return nil, &ConnectError{Status: StatusUnreachable, Host: host, Err: fmt.Errorf("%w: %v", ErrTimeout, err)}
+		}
+		// 仅没有共同的公钥算法时说明主机不提供该类型的公钥，其他错误如连接重置为主机失败
+		if err != nil && strings.Contains(err.Error(), "no common algorithm for host key") {
+			return nil, &ConnectError{Status: StatusFailed, Host: host, Err: fmt.Errorf("%w: %v", ErrNoHostKeyAlgorithm, err)}
+		}
+		return nil, &ConnectError{Status: StatusUnreachable, Host: host, Err: err}
+	}
+	return hostKey, nil
+}
+
+// PinHostKey 通过跳板机连接主机，用当前的公钥替换 known_hosts 中的公钥
+func PinHostKey(ctx context.Context, host *config.Host, timeout time.Duration) (gossh.PublicKey, error) {
+	if err := host.JumpError(); err != nil {
+		return nil, err
+	}
+
+	client := NewClient()
+	defer client.Close()
+	for _, jump := range host.JumpList {
+		if err := client.Connect(ctx, jump, timeout); err != nil {
+			return nil, err
+		}
+	}
+
+	algorithms := slices.DeleteFunc(gossh.SupportedAlgorithms().HostKeys, func(algorithm string) bool {
+		return strings.Contains(algorithm, "-cert-")
+	})
+	if host.HostKeyAlgorithms != "" {
+		algorithms = algorithmList(host.HostKeyAlgorithms, algorithms, gossh.InsecureAlgorithms().HostKeys)
+	}
+	key, err := client.FetchHostKey(ctx, host, algorithms, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := RemoveKnownHost(host); err != nil {
+		return nil, err
+	}
+	return key, appendKnownHost(host, key)
+}
@@ -0,0 +1,150 @@
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/PWZER/dssh/config"
+)
+
+const lastRunFileName = "last_run.json"
+
+// LastRun 记录上一次执行的任务参数及各主机执行结果
+type LastRun struct {
+	Username      string            `json:"username,omitempty"`
+	Port          uint16            `json:"port,omitempty"`
+	ProxyJump     string            `json:"proxyJump,omitempty"`
+	IdentityFiles []string          `json:"identityFiles,omitempty"`
+	Command       string            `json:"command,omitempty"`
+	Script        string            `json:"script,omitempty"`
+	Module        string            `json:"module,omitempty"`
+	UploadSrc     string            `json:"uploadSrc,omitempty"`
+	UploadDest    string            `json:"uploadDest,omitempty"`
+	DownloadSrc   string            `json:"downloadSrc,omitempty"`
+	DownloadDest  string            `json:"downloadDest,omitempty"`
+	Template      bool              `json:"template,omitempty"`
+	Vars          map[string]string `json:"vars,omitempty"`
+	Output        string            `json:"output,omitempty"`
+	Timeout       time.Duration     `json:"timeout,omitempty"`
+	Report        *Report           `json:"report"`
+}
+
+func lastRunPath() string {
+	return filepath.Join(config.StateDir(), lastRunFileName)
+}
+
+func saveLastRun(tc *config.TaskConfig, report *Report) error {
+	lastRun := &LastRun{
+		Username:      tc.Username,
+		Port:          tc.Port,
+		ProxyJump:     tc.ProxyJump,
+		IdentityFiles: tc.IdentityFiles,
+		Command:       tc.Command,
+		Script:        tc.Script,
+		Module:        tc.Module,
+		UploadSrc:     tc.UploadSrc,
+		UploadDest:    tc.UploadDest,
+		DownloadSrc:   tc.DownloadSrc,
+		DownloadDest:  tc.DownloadDest,
+		Template:      tc.Template,
+		Vars:          tc.Vars,
+		Output:        tc.Output,
+		Timeout:       tc.Timeout,
+		Report:        report,
+	}
+	data, err := json.MarshalIndent(lastRun, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(config.StateDir(), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(lastRunPath(), data, 0600)
+}
+
+func LoadLastRun() (*LastRun, error) {
+	data, err := os.ReadFile(lastRunPath())
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no last run found in %s", config.StateDir())
+	} else if err != nil {
+		return nil, err
+	}
+
+	lastRun := &LastRun{}
+	if err := json.Unmarshal(data, lastRun); err != nil {
+		return nil, fmt.Errorf("invalid last run file %s: %v", lastRunPath(), err)
+	}
+	if lastRun.Report == nil {
+		return nil, fmt.Errorf("invalid last run file %s: report is missing", lastRunPath())
+	}
+	return lastRun, nil
+}
+
+// FailedTargets 上次执行未成功的主机，包括因出错而未执行的主机
+func (r *LastRun) FailedTargets() (targets []string) {
+	for _, host := range r.Report.Hosts {
+		if host.Status == StatusOK || slices.Contains(targets, host.Target) {
+			continue
+		}
+		targets = append(targets, host.Target)
+	}
+	return targets
+}
+
+// ApplyFailed 使用上次失败的主机及相同的命令、脚本或模块重建任务配置，
+// 模板变量以本次的 --var 优先，未指定输出模式及超时时使用上次的
+func (r *LastRun) ApplyFailed(tc *config.TaskConfig) error {
+	targets := r.FailedTargets()
+	if len(targets) == 0 {
+		return fmt.Errorf("no failed hosts in the last run")
+	}
+
+	tc.Targets = targets
+	tc.Username = r.Username
+	tc.Port = r.Port
+	tc.ProxyJump = r.ProxyJump
+	tc.IdentityFiles = r.IdentityFiles
+	tc.Command = r.Command
+	tc.Script = r.Script
+	tc.Module = r.Module
+	tc.UploadSrc = r.UploadSrc
+	tc.UploadDest = r.UploadDest
+	tc.DownloadSrc = r.DownloadSrc
+	tc.DownloadDest = r.DownloadDest
+	tc.Template = tc.Template || r.Template
+	vars := maps.Clone(r.Vars)
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	maps.Copy(vars, tc.Vars)
+	tc.Vars = vars
+	if tc.Output == config.OutputStream && r.Output != "" {
+		tc.Output = r.Output
+	}
+	if tc.Timeout == 0 {
+		tc.Timeout = r.Timeout
+	}
+	return nil
+}
+
+func (r *LastRun) Print() {
+	switch {
+	case r.Command != "":
+		fmt.Printf("command: %s\n", r.Command)
+	case r.Script != "":
+		fmt.Printf("script: %s\n", r.Script)
+	case r.Module != "":
+		fmt.Printf("module: %s\n", r.Module)
+	case r.UploadSrc != "":
+		fmt.Printf("put: %s => %s\n", r.UploadSrc, r.UploadDest)
+	case r.DownloadSrc != "":
+		fmt.Printf("get: %s => %s\n", r.DownloadSrc, r.DownloadDest)
+	}
+	fmt.Printf("time: %s\n\n", r.Report.StartTime.Local().Format("2006-01-02 15:04:05"))
+	r.Report.writeTable(os.Stdout)
+}
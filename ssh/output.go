@@ -0,0 +1,206 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/PWZER/dssh/config"
+	"github.com/PWZER/dssh/utils"
+)
+
+// 按行输出，每行前添加主机名前缀
+type prefixWriter struct {
+	mutex  *sync.Mutex
+	writer io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := w.writeLine(w.buf[:i+1]); err != nil {
+			return len(p), err
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *prefixWriter) writeLine(line []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	_, err := fmt.Fprintf(w.writer, "%s%s", w.prefix, line)
+	return err
+}
+
+func (w *prefixWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	line := append(w.buf, '\n')
+	w.buf = nil
+	return w.writeLine(line)
+}
+
+// 标准输出和错误输出合并写入同一个缓冲区
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+type taskOutput struct {
+	Stdout io.Writer
+	Stderr io.Writer
+
+	stdoutBuffer   *bytes.Buffer
+	stderrBuffer   *bytes.Buffer
+	combinedBuffer *syncBuffer
+	flushers       []interface{ Flush() error }
+	files          []*os.File
+}
+
+func outputFileName(task *config.Task) string {
+	return strings.ReplaceAll(task.Target.Name(), string(filepath.Separator), "_")
+}
+
+// uniqueOutputFileName 同一主机出现多次时加上任务序号，避免输出文件互相覆盖
+func (e *executor) uniqueOutputFileName(task *config.Task) string {
+	name := outputFileName(task)
+	for _, other := range e.tc.Tasks {
+		if other != task && outputFileName(other) == name {
+			return fmt.Sprintf("%s.%d", name, task.Index+1)
+		}
+	}
+	return name
+}
+
+func (e *executor) newTaskOutput(task *config.Task) (output *taskOutput, err error) {
+	output = &taskOutput{Stdout: os.Stdout, Stderr: os.Stderr}
+
+	switch task.Outputer {
+	case config.OutputPrefix:
+		prefix := fmt.Sprintf("%-*s | ", e.nameWidth, task.Target.Name())
+		stdout := &prefixWriter{mutex: &e.mutex, writer: os.Stdout, prefix: prefix}
+		stderr := &prefixWriter{mutex: &e.mutex, writer: os.Stderr, prefix: prefix}
+		output.Stdout, output.Stderr = stdout, stderr
+		output.flushers = append(output.flushers, stdout, stderr)
+	case config.OutputBuffer:
+		output.stdoutBuffer = &bytes.Buffer{}
+		output.stderrBuffer = &bytes.Buffer{}
+		output.Stdout, output.Stderr = output.stdoutBuffer, output.stderrBuffer
+	case config.OutputGroup:
+		output.combinedBuffer = &syncBuffer{}
+		output.Stdout, output.Stderr = output.combinedBuffer, output.combinedBuffer
+	}
+
+	if e.tc.OutputDir != "" {
+		if err := os.MkdirAll(e.tc.OutputDir, 0755); err != nil {
+			return nil, err
+		}
+		name := filepath.Join(e.tc.OutputDir, e.uniqueOutputFileName(task))
+		stdoutFile, err := os.Create(name + ".stdout")
+		if err != nil {
+			return nil, err
+		}
+		output.files = append(output.files, stdoutFile)
+
+		stderrFile, err := os.Create(name + ".stderr")
+		if err != nil {
+			output.Close()
+			return nil, err
+		}
+		output.files = append(output.files, stderrFile)
+
+		output.Stdout = io.MultiWriter(output.Stdout, stdoutFile)
+		output.Stderr = io.MultiWriter(output.Stderr, stderrFile)
+	}
+	return output, nil
+}
+
+func (o *taskOutput) Buffered() bool {
+	return o.stdoutBuffer != nil
+}
+
+func (o *taskOutput) Grouped() bool {
+	return o.combinedBuffer != nil
+}
+
+func (o *taskOutput) Combined() []byte {
+	return o.combinedBuffer.buffer.Bytes()
+}
+
+// Close 输出未换行的剩余内容并关闭文件
+func (o *taskOutput) Close() {
+	for _, flusher := range o.flushers {
+		flusher.Flush()
+	}
+	for _, file := range o.files {
+		file.Close()
+	}
+}
+
+type outputGroup struct {
+	output   []byte
+	exitCode int
+	names    []string
+}
+
+// 按输出内容及退出码对执行完成的任务分组，主机数多的分组在前
+func groupResults(results []*taskResult) []*outputGroup {
+	groups := make([]*outputGroup, 0)
+	for _, result := range results {
+		if result == nil || !result.Finished() {
+			continue
+		}
+
+		var group *outputGroup
+		for _, g := range groups {
+			if g.exitCode == result.ExitCode && bytes.Equal(g.output, result.Output) {
+				group = g
+				break
+			}
+		}
+		if group == nil {
+			group = &outputGroup{output: result.Output, exitCode: result.ExitCode}
+			groups = append(groups, group)
+		}
+		group.names = append(group.names, result.Task.Target.Name())
+	}
+	slices.SortStableFunc(groups, func(a, b *outputGroup) int {
+		return len(b.names) - len(a.names)
+	})
+	return groups
+}
+
+func printGroups(results []*taskResult) {
+	for _, group := range groupResults(results) {
+		title := fmt.Sprintf("%s (%d)", utils.FoldHostNames(group.names), len(group.names))
+		if group.exitCode != 0 {
+			title = fmt.Sprintf("%s exit code: %d", title, group.exitCode)
+		}
+		separator := strings.Repeat("-", min(len(title), GetTerminalWidth()))
+		fmt.Printf("%s\n%s\n%s\n", separator, title, separator)
+
+		os.Stdout.Write(group.output)
+		if len(group.output) > 0 && group.output[len(group.output)-1] != '\n' {
+			fmt.Println()
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package ssh
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/PWZER/dssh/config"
+)
+
+const (
+	preflightTimeout  = 5 * time.Second
+	preflightParallel = 64
+)
+
+// 探测任务的第一跳，有跳板机时为第一个跳板机
+func probeTask(ctx context.Context, task *config.Task) error {
+	if err := task.Target.JumpError(); err != nil {
+		return &ConnectError{Status: StatusFailed, Host: task.Target, Err: err}
+	}
+
+	host := task.Target
+	if len(task.Target.JumpList) > 0 {
+		host = task.Target.JumpList[0]
+	}
+
+	timeout := task.ConnectTimeout
+	if timeout == 0 {
+		timeout = host.ConnectTimeout
+	}
+	if timeout == 0 {
+		timeout = preflightTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host.EndPoint())
+	if err != nil {
+		return &ConnectError{Status: StatusUnreachable, Host: host, Err: err}
+	}
+	return conn.Close()
+}
+
+// preflight 并发探测所有任务，从 tc.Tasks 中移除无法连接的任务并重新编号，返回被移除任务的结果
+func preflight(ctx context.Context, tc *config.TaskConfig) (dropped []*taskResult) {
+	errs := make([]error, len(tc.Tasks))
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, preflightParallel)
+	for i, task := range tc.Tasks {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int, task *config.Task) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			errs[i] = probeTask(ctx, task)
+		}(i, task)
+	}
+	wg.Wait()
+
+	tasks := make([]*config.Task, 0, len(tc.Tasks))
+	for i, task := range tc.Tasks {
+		if errs[i] != nil {
+			dropped = append(dropped, &taskResult{Task: task, ExitCode: -1, Err: errs[i]})
+			continue
+		}
+		task.Index = len(tasks)
+		tasks = append(tasks, task)
+	}
+	tc.Tasks = tasks
+	return dropped
+}
@@ -0,0 +1,107 @@
+package ssh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+
+	"github.com/PWZER/dssh/config"
+)
+
+var (
+	// ErrBatchMode 批处理模式下需要输入时直接失败
+	ErrBatchMode = errors.New("prompt is not allowed in batch mode")
+	// ErrNoTerminal 标准输入不是终端时无法输入
+	ErrNoTerminal = errors.New("stdin is not a terminal")
+)
+
+// promptBroker 串行化多个主机在终端上的输入，并标明是哪个主机在询问
+type promptBroker struct {
+	mutex  sync.Mutex
+	reader *bufio.Reader
+}
+
+var prompts = &promptBroker{reader: bufio.NewReader(os.Stdin)}
+
+// ask 在终端上询问，echo 为 false 时不回显输入
+func (b *promptBroker) ask(host *config.Host, question string, echo bool) (string, error) {
+	if host.BatchMode {
+		return "", fmt.Errorf("%w: %s", ErrBatchMode, strings.TrimRight(question, ": "))
+	}
+	fd := int(os.Stdin.Fd())
+	terminal := term.IsTerminal(fd)
+	useAskpass, allowAskpass := askpassMode()
+	if !terminal && !useAskpass && !allowAskpass {
+		return "", fmt.Errorf("%w: %s", ErrNoTerminal, strings.TrimRight(question, ": "))
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if useAskpass || !terminal {
+		return askpass(fmt.Sprintf("[%s] %s", host.Summary(), question))
+	}
+	fmt.Printf("[%s] %s", host.Summary(), question)
+	if echo {
+		answer, err := b.reader.ReadString('\n')
+		return strings.TrimSpace(answer), err
+	}
+	answer, err := term.ReadPassword(fd)
+	fmt.Println()
+	return strings.TrimSpace(string(answer)), err
+}
+
+// readLine 输出提示并读取一行，与主机的询问共用同一个 reader 及锁，标准输入不是终端时也可读取
+func (b *promptBroker) readLine(prompt string) (string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := b.reader.ReadString('\n')
+	return strings.TrimSpace(line), err
+}
+
+// password 询问密码或私钥密码
+func (b *promptBroker) password(host *config.Host, prompt string) (string, error) {
+	return b.ask(host, prompt, false)
+}
+
+// confirm 询问 yes/no，批处理模式或非终端时返回 false
+func (b *promptBroker) confirm(host *config.Host, question string) bool {
+	answer, err := b.ask(host, question+" (yes/no)? ", true)
+	return err == nil && strings.EqualFold(answer, "yes")
+}
+
+// keyboardInteractive 返回主机的 keyboard-interactive 回调，问题逐个通过 broker 询问，
+// 每次连接只使用一次 passwordCommand 的输出
+func (b *promptBroker) keyboardInteractive(host *config.Host) func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+	var tried bool
+	return func(user, instruction string, questions []string, echos []bool) (answers []string, err error) {
+		if useAskpass, _ := askpassMode(); len(questions) > 0 && instruction != "" && !host.BatchMode && !useAskpass {
+			b.mutex.Lock()
+			fmt.Printf("[%s] %s\n", host.Summary(), instruction)
+			b.mutex.Unlock()
+		}
+		for i, question := range questions {
+			// 不回显的问题先使用一次 passwordCommand 的输出，被拒绝后再询问
+			if !echos[i] && !tried {
+				tried = true
+				if answer, ok := passwordCommand(host, promptKeyboardInteractive, question); ok {
+					answers = append(answers, answer)
+					continue
+				}
+			}
+			answer, err := b.ask(host, question, echos[i])
+			if err != nil {
+				return nil, err
+			}
+			answers = append(answers, answer)
+		}
+		return answers, nil
+	}
+}
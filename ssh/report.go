@@ -0,0 +1,161 @@
+package ssh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/PWZER/dssh/config"
+)
+
+type HostReport struct {
+	Target   string  `json:"target"`
+	Name     string  `json:"name"`
+	Host     string  `json:"host"`
+	Status   string  `json:"status"`
+	ExitCode int     `json:"exitCode"`
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	StartTime time.Time     `json:"startTime"`
+	Duration  float64       `json:"duration"`
+	Total     int           `json:"total"`
+	Failed    int           `json:"failed"`
+	Skipped   int           `json:"skipped"`
+	Hosts     []*HostReport `json:"hosts"`
+}
+
+// RunError 存在失败主机时由 Start 返回，ExitStatus 作为进程退出码
+type RunError struct {
+	Failed int
+	Total  int
+	Err    error
+}
+
+func (e *RunError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%d of %d hosts failed", e.Failed, e.Total)
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RunError) ExitStatus() int {
+	if errors.Is(e.Err, ErrInterrupted) {
+		return 130
+	}
+	return max(min(e.Failed, 125), 1)
+}
+
+func (r *taskResult) Status() string {
+	if r.Err == nil {
+		return StatusOK
+	}
+	var connectErr *ConnectError
+	if errors.As(r.Err, &connectErr) {
+		return connectErr.Status
+	}
+	if errors.Is(r.Err, ErrInterrupted) {
+		return StatusInterrupted
+	}
+	if errors.Is(r.Err, ErrTimeout) {
+		return StatusTimeout
+	}
+	return StatusFailed
+}
+
+func newHostReport(task *config.Task, result *taskResult) *HostReport {
+	hostReport := &HostReport{
+		Target:   task.Origin,
+		Name:     task.Target.Name(),
+		Host:     task.Target.Summary(),
+		Status:   StatusSkipped,
+		ExitCode: -1,
+	}
+	if result != nil {
+		hostReport.Status = result.Status()
+		hostReport.ExitCode = result.ExitCode
+		hostReport.Duration = result.Duration.Seconds()
+		// 非 0 退出码已体现在 exitCode 中
+		if _, ok := result.Err.(*gossh.ExitError); result.Err != nil && !ok {
+			hostReport.Error = result.Err.Error()
+		}
+	}
+	return hostReport
+}
+
+// dropped 为预检时移除的任务结果
+func newReport(tc *config.TaskConfig, results []*taskResult, dropped []*taskResult, startTime time.Time) *Report {
+	report := &Report{
+		StartTime: startTime,
+		Duration:  time.Since(startTime).Seconds(),
+		Total:     len(tc.Tasks) + len(dropped),
+		Hosts:     make([]*HostReport, 0, len(tc.Tasks)+len(dropped)),
+	}
+	for _, task := range tc.Tasks {
+		report.Hosts = append(report.Hosts, newHostReport(task, results[task.Index]))
+	}
+	for _, result := range dropped {
+		report.Hosts = append(report.Hosts, newHostReport(result.Task, result))
+	}
+
+	for _, hostReport := range report.Hosts {
+		switch hostReport.Status {
+		case StatusOK:
+		case StatusSkipped:
+			report.Skipped++
+		default:
+			report.Failed++
+		}
+	}
+	return report
+}
+
+func (r *Report) writeTable(out io.Writer) {
+	w := tabwriter.NewWriter(out, 12, 8, 4, ' ', 0)
+	fmt.Fprintln(w, "NAME\tHOST\tSTATUS\tEXIT\tDURATION\tERROR\t")
+	for _, host := range r.Hosts {
+		exitCode := ""
+		if host.ExitCode >= 0 {
+			exitCode = fmt.Sprintf("%d", host.ExitCode)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.2fs\t%s\t\n",
+			host.Name, host.Host, host.Status, exitCode, host.Duration, host.Error)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "total: %d, ok: %d, failed: %d, skipped: %d, duration: %.2fs\n",
+		r.Total, r.Total-r.Failed-r.Skipped, r.Failed, r.Skipped, r.Duration)
+}
+
+func (r *Report) Write(format, file string) (err error) {
+	out := os.Stderr
+	if file != "" {
+		if out, err = os.Create(file); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	switch format {
+	case config.ReportTable:
+		r.writeTable(out)
+	case config.ReportJSON:
+		data, err := json.MarshalIndent(r, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"syscall"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/PWZER/dssh/config"
+	"github.com/PWZER/dssh/logger"
+)
+
+// connectErrorClass 按 config.RetryOn* 对连接错误分类，非连接错误返回空字符串
+func connectErrorClass(err error) string {
+	var connectErr *ConnectError
+	if !errors.As(err, &connectErr) {
+		return ""
+	}
+	if connectErr.Status == StatusAuthFailed {
+		return config.RetryOnAuth
+	}
+	if errors.Is(err, ErrHostKey) {
+		return "" // 公钥校验失败重试无意义
+	}
+
+	var netErr net.Error
+	var openChannelErr *gossh.OpenChannelError
+	switch {
+	case errors.Is(err, ErrTimeout), errors.As(err, &netErr) && netErr.Timeout():
+		return config.RetryOnTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return config.RetryOnRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, io.EOF):
+		return config.RetryOnReset
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH), errors.As(err, &openChannelErr):
+		// 跳板机无法连接到下一跳时返回 OpenChannelError
+		return config.RetryOnUnreachable
+	default:
+		return config.RetryOnHandshake
+	}
+}
+
+// ConnectWithRetry 按重试策略连接主机，每次失败后指数退避
+func (c *Client) ConnectWithRetry(ctx context.Context, host *config.Host, timeout time.Duration, policy *config.RetryPolicy) error {
+	for attempt := 1; ; attempt++ {
+		err := c.Connect(ctx, host, timeout)
+		if err == nil || policy == nil || attempt >= policy.Attempts {
+			return err
+		}
+		if !slices.Contains(policy.RetryOn, connectErrorClass(err)) {
+			return err
+		}
+
+		delay := policy.Delay(attempt)
+		logger.Warnf("%v, retry after %s (%d / %d)", err, delay, attempt+1, policy.Attempts)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -1,66 +1,121 @@
 package ssh
 
 import (
+	"context"
 	"fmt"
-	"math"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/PWZER/dssh/config"
+	"github.com/PWZER/dssh/logger"
 	"github.com/PWZER/dssh/utils"
-	"golang.org/x/term"
 )
 
-func taskStart(task *config.Task) (err error) {
-	client := NewClient()
+func taskStart(ctx context.Context, task *config.Task, client *Client) (exitCode int, err error) {
+	defer client.Close()
+
+	// 取消时关闭连接，中断正在执行的任务
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	defer stop()
+
+	// 跳板机配置错误时不连接，如 ProxyJump 循环
+	if err = task.Target.JumpError(); err != nil {
+		return -1, &ConnectError{Status: StatusFailed, Host: task.Target, Err: err}
+	}
+
 	for _, host := range append(task.Target.JumpList, task.Target) {
-		if err = client.Connect(host); err != nil {
-			return err
+		timeout := task.ConnectTimeout
+		if timeout == 0 {
+			timeout = host.ConnectTimeout
+		}
+		if err = client.ConnectWithRetry(ctx, host, timeout, task.Retry); err != nil {
+			return -1, err
 		}
 	}
 
+	// 端口转发只用于交互式登录，批量执行时多个主机会监听相同的本地端口
+	target := task.Target
+	if !isInteractiveTask(task) && len(target.LocalForwards)+len(target.RemoteForwards)+len(target.DynamicForwards) > 0 {
+		fmt.Fprintf(os.Stderr, "[WARN] %s: LocalForward, RemoteForward and DynamicForward are only set up for interactive shell, ignored\n", target.Name())
+	}
+
 	if task.Command != "" {
-		_, err = client.Execute(task.Command)
-		return err
+		client.Timeout = task.Timeout
+		return client.Execute(task.Command)
+	}
+
+	// 文件传输超时时关闭连接
+	if task.Timeout > 0 && (task.DownloadSrc != "" || task.UploadSrc != "") {
+		timer := time.AfterFunc(task.Timeout, func() { client.Close() })
+		defer func() {
+			if !timer.Stop() && err != nil {
+				err = fmt.Errorf("%w: transfer not finished in %s", ErrTimeout, task.Timeout)
+			}
+		}()
 	}
 
 	if task.DownloadSrc != "" {
-		return client.Download(task.DownloadSrc, task.DownloadDest)
+		return 0, client.Download(task.DownloadSrc, task.DownloadDest)
 	}
 
 	if task.UploadSrc != "" {
-		return client.Upload(task.UploadSrc, task.UploadDest)
+		return 0, client.Upload(task.UploadSrc, task.UploadDest)
 	}
 
 	utils.SetWindowTitle(task.Target.HostName)
 	defer utils.SetWindowTitle("")
-	return client.Shell(task.RemoteListen, task.ProxyServer)
+	return 0, client.Shell(task.RemoteListen, task.ProxyServer)
 }
 
 func Start(tc *config.TaskConfig) error {
 	if len(tc.Tasks) == 0 {
-		return fmt.Errorf("one of \"<host>\" or \"--host <host>\" or \"--tags\" is required!")
+		return fmt.Errorf("one of \"<host>\" or \"--host <host>\" or \"--tags\" or \"--labels\" is required!")
 	}
 
-	for _, task := range tc.Tasks {
-		termWidth, _, err := term.GetSize(int(os.Stdin.Fd()))
-		if err == nil && termWidth > 0 {
-			message := fmt.Sprintf("-----> [%d / %d] %s %s <-----",
-				task.Index+1, len(tc.Tasks), task.Target.Summary(), task.Message)
-			fillLen := termWidth - int(math.Mod(float64(len(message)), float64(termWidth)))
-			if fillLen > 0 {
-				message = fmt.Sprintf("\033[1;32m%s%s\033[0m", message, strings.Repeat("-", fillLen))
-			}
-			fmt.Fprintln(os.Stderr, message)
+	// Ctrl-C 取消所有执行中的任务，再次 Ctrl-C 直接退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	startTime := time.Now()
+	interactive := isInteractiveTask(tc.Tasks[0])
+
+	var dropped []*taskResult
+	if tc.Preflight {
+		if dropped = preflight(ctx, tc); ctx.Err() != nil {
+			return ErrInterrupted
 		}
+	}
 
-		if err := taskStart(task); err != nil {
-			if tc.FailedContinue {
-				fmt.Printf("[ERROR] %s\n", err)
-				continue
-			}
-			return err
+	var results []*taskResult
+	var err error
+	if len(tc.Tasks) > 0 {
+		e, newErr := newExecutor(tc)
+		if newErr != nil {
+			return newErr
+		}
+		err = e.run(ctx)
+		results = e.results
+	}
+
+	report := newReport(tc, results, dropped, startTime)
+	if tc.Report == config.ReportJSON || (tc.Report == config.ReportTable && report.Total > 1) {
+		if err := report.Write(tc.Report, tc.ReportFile); err != nil {
+			fmt.Printf("[ERROR] write report failed: %s\n", err)
 		}
 	}
+
+	// 交互式登录不记录，避免覆盖上次批量执行的结果
+	if !interactive {
+		if err := saveLastRun(tc, report); err != nil {
+			logger.Warnf("save last run failed: %v", err)
+		}
+	}
+
+	if err != nil || report.Failed > 0 {
+		return &RunError{Failed: report.Failed, Total: report.Total, Err: err}
+	}
 	return nil
 }
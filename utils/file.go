@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes data to a temp file in the same directory then renames it to path, the symlink
+// is followed, the existing file is backed up as <path>.bak and its mode is kept, new files are 0600
+func WriteFileAtomic(path string, data []byte) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	mode := os.FileMode(0600)
+	if stat, err := os.Stat(path); err == nil {
+		mode = stat.Mode().Perm()
+		original, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path+".bak", original, mode); err != nil {
+			return fmt.Errorf("backup %s failed: %v", path, err)
+		}
+	} else if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var hostNumberRegex = regexp.MustCompile(`^(.*?)(\d+)(\D*)$`)
+
+type hostNumberGroup struct {
+	prefix  string
+	suffix  string
+	width   int // 补零宽度，0 表示不补零
+	numbers []int
+}
+
+func (g *hostNumberGroup) String() string {
+	slices.Sort(g.numbers)
+	g.numbers = slices.Compact(g.numbers)
+	if len(g.numbers) == 1 {
+		return fmt.Sprintf("%s%0*d%s", g.prefix, g.width, g.numbers[0], g.suffix)
+	}
+
+	ranges := make([]string, 0)
+	for i := 0; i < len(g.numbers); {
+		j := i
+		for j+1 < len(g.numbers) && g.numbers[j+1] == g.numbers[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, fmt.Sprintf("%0*d", g.width, g.numbers[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%0*d-%0*d", g.width, g.numbers[i], g.width, g.numbers[j]))
+		}
+		i = j + 1
+	}
+	return fmt.Sprintf("%s[%s]%s", g.prefix, strings.Join(ranges, ","), g.suffix)
+}
+
+// 数字部分无前导零时可并入补零宽度不超过其长度的分组，如 web-10 可并入 web-[01-09]
+func (g *hostNumberGroup) accept(prefix, suffix, digits string) bool {
+	if g.prefix != prefix || g.suffix != suffix {
+		return false
+	}
+	if len(digits) > 1 && digits[0] == '0' {
+		return g.width == len(digits)
+	}
+	return g.width <= len(digits)
+}
+
+// FoldHostNames 将主机名折叠为紧凑格式，如 web-01,web-02,web-03,db-03 => web-[01-03],db-03
+func FoldHostNames(names []string) string {
+	groups := make([]fmt.Stringer, 0)
+	numberGroups := make([]*hostNumberGroup, 0)
+	for _, name := range names {
+		match := hostNumberRegex.FindStringSubmatch(name)
+		if match == nil {
+			groups = append(groups, stringer(name))
+			continue
+		}
+		prefix, digits, suffix := match[1], match[2], match[3]
+
+		number, err := strconv.Atoi(digits)
+		if err != nil {
+			groups = append(groups, stringer(name))
+			continue
+		}
+
+		var group *hostNumberGroup
+		for _, g := range numberGroups {
+			if g.accept(prefix, suffix, digits) {
+				group = g
+				break
+			}
+		}
+		if group == nil {
+			group = &hostNumberGroup{prefix: prefix, suffix: suffix}
+			if len(digits) > 1 && digits[0] == '0' {
+				group.width = len(digits)
+			}
+			numberGroups = append(numberGroups, group)
+			groups = append(groups, group)
+		}
+		group.numbers = append(group.numbers, number)
+	}
+
+	folded := make([]string, 0, len(groups))
+	for _, group := range groups {
+		folded = append(folded, group.String())
+	}
+	return strings.Join(slices.Compact(folded), ",")
+}
+
+type stringer string
+
+func (s stringer) String() string {
+	return string(s)
+}
@@ -1,9 +1,9 @@
 package utils
 
 import (
+	"crypto/rand"
 	"fmt"
-	"math/rand"
-	"time"
+	"math/big"
 )
 
 type PasswordGenerator struct {
@@ -16,21 +16,43 @@ type PasswordGenerator struct {
 }
 
 func (pg *PasswordGenerator) GenPassword() error {
+	passwd, err := pg.Generate()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Password: %#v\n", passwd)
+	return nil
+}
+
+// randInt returns a uniform random number in [0, n) from crypto/rand
+func randInt(n int) (int, error) {
+	value, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(value.Int64()), nil
+}
+
+// Generate returns a random password of the charset, it's from crypto/rand to be saved as credential
+func (pg *PasswordGenerator) Generate() (string, error) {
 	charset := []byte("")
-	rand.Seed(time.Now().UnixNano())
-	if !pg.DisabledDigital {
-		for i := 0; i <= rand.Intn(10); i++ {
-			charset = append(charset, []byte("0123456789")...)
+	for _, chars := range []struct {
+		disabled bool
+		chars    string
+	}{
+		{pg.DisabledDigital, "0123456789"},
+		{pg.DisabledLowercase, "abcdefghijklmnopqrstuvwxyz"},
+		{pg.DisabledUppercase, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+	} {
+		if chars.disabled {
+			continue
 		}
-	}
-	if !pg.DisabledLowercase {
-		for i := 0; i <= rand.Intn(10); i++ {
-			charset = append(charset, []byte("abcdefghijklmnopqrstuvwxyz")...)
+		repeat, err := randInt(10)
+		if err != nil {
+			return "", err
 		}
-	}
-	if !pg.DisabledUppercase {
-		for i := 0; i <= rand.Intn(10); i++ {
-			charset = append(charset, []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZ")...)
+		for i := 0; i <= repeat; i++ {
+			charset = append(charset, []byte(chars.chars)...)
 		}
 	}
 	if !pg.DisabledPunctuation {
@@ -38,16 +60,16 @@ func (pg *PasswordGenerator) GenPassword() error {
 	}
 
 	if len(charset) == 0 {
-		return fmt.Errorf("Charset empty!")
+		return "", fmt.Errorf("Charset empty!")
 	}
 
-	rand.Shuffle(len(charset), func(i, j int) {
-		charset[i], charset[j] = charset[j], charset[i]
-	})
 	passwd := make([]byte, pg.PasswordLength)
 	for i := 0; i < pg.PasswordLength; i++ {
-		passwd[i] = charset[rand.Intn(len(charset))]
+		index, err := randInt(len(charset))
+		if err != nil {
+			return "", err
+		}
+		passwd[i] = charset[index]
 	}
-	fmt.Printf("Password: %#v\n", string(passwd))
-	return nil
+	return string(passwd), nil
 }